@@ -1,36 +1,117 @@
 package main
 
 import (
+	"chat-session/internal/auth"
 	"chat-session/internal/cache"
 	"chat-session/internal/config"
+	"chat-session/internal/conversation"
+	"chat-session/internal/delivery"
+	"chat-session/internal/migration"
+	"chat-session/internal/outbox"
+	"chat-session/internal/presence"
 	"chat-session/internal/repository"
+	"chat-session/internal/room"
 	"chat-session/internal/router"
 	"chat-session/internal/session"
+	"chat-session/internal/unread"
+	"context"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	//migrate subcommand only needs database
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	//init config
 	cfg := config.InitConfig()
 	defer cfg.Free()
 
+	//apply pending migrations, replicas starting together wait on the migration lock
+	if cfg.Env.MigrateOnStart {
+		m, err := migration.New(cfg.DB, cfg.Env.DBDriver)
+		if err != nil {
+			panic(err)
+		}
+		applied, err := m.Up(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		zap.S().Infof("%d migration(s) applied", len(applied))
+	}
+
 	//init cache
-	c := cache.NewCache(cfg.RDB, cfg.Env)
+	c, err := cache.NewCache(cfg.RDB, cfg.Env)
+	if err != nil {
+		panic(err)
+	}
 
 	//init repository
-	messageRepo := repository.NewMessage(cfg.DB)
+	messageRepo := repository.NewMessage(cfg.DB, cfg.Env)
+	roomRepo := repository.NewRoom(cfg.DB, cfg.Env)
+	outboxRepo := repository.NewOutbox(cfg.DB, cfg.Env)
+
+	//init authenticator
+	authenticator, err := auth.NewJWT(cfg.Env)
+	if err != nil {
+		panic(err)
+	}
 
 	//init service
-	s := session.NewService(c, messageRepo)
+	unreadCounter := unread.NewCounter(c, messageRepo)
+	presenceTracker := presence.NewTracker(c, cfg.Env)
+	deliveryService, err := delivery.NewService(c, messageRepo, unreadCounter, presenceTracker, cfg.Env)
+	if err != nil {
+		panic(err)
+	}
+	s := session.NewService(c, messageRepo, roomRepo, authenticator, unreadCounter, deliveryService, presenceTracker, cfg.Env)
+	conversationService := conversation.NewService(messageRepo, unreadCounter)
+	roomService := room.NewService(roomRepo, deliveryService)
+	presenceService := presence.NewService(presenceTracker, presence.NewPolicy(messageRepo, roomRepo))
+
+	//outbox write path leaves publish to relay
+	if cfg.Env.WritePath == delivery.WriteOutbox {
+		relay := outbox.NewRelay(outboxRepo, deliveryService, cfg.Env)
+		relay.Start()
+		defer relay.Stop()
+	}
 
 	//init router
-	r := router.InitRouter(s)
+	r := router.InitRouter(s, conversationService, roomService, presenceService, authenticator)
 
 	//start service
-	zap.S().Infof("start on %v", cfg.Env.Port)
-	err := http.ListenAndServe(cfg.Env.Port, r)
-	if err != nil {
+	srv := &http.Server{Addr: cfg.Env.Port, Handler: r}
+	errChan := make(chan error, 1)
+	go func() {
+		zap.S().Infof("start on %v", cfg.Env.Port)
+		errChan <- srv.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errChan:
 		panic(err)
+	case sig := <-quit:
+		zap.S().Infof("receive %v, shutting down", sig)
+	}
+
+	//stop accepting request first, then drain websocket sessions which http server does not track after upgrade
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Env.ShutdownTimeout)*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		zap.S().Errorf("srv.Shutdown: %v", err)
+	}
+	err = s.Shutdown(ctx)
+	if err != nil {
+		zap.S().Errorf("s.Shutdown: %v", err)
 	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/migration"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate handles `migrate up|down [steps]|status`, down reverts one migration unless steps is given
+func runMigrate(args []string) {
+	steps := 1
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+	if args[0] == "down" && len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Println(migrateUsage)
+			os.Exit(2)
+		}
+		steps = n
+	}
+
+	cfg := config.InitDBConfig()
+	defer cfg.Free()
+
+	m, err := migration.New(cfg.DB, cfg.Env.DBDriver)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			panic(err)
+		}
+		for _, a := range applied {
+			fmt.Printf("applied %04d_%s\n", a.Version, a.Name)
+		}
+		fmt.Printf("%d migration(s) applied\n", len(applied))
+	case "down":
+		reverted, err := m.Down(ctx, steps)
+		if err != nil {
+			panic(err)
+		}
+		for _, r := range reverted {
+			fmt.Printf("reverted %04d_%s\n", r.Version, r.Name)
+		}
+		fmt.Printf("%d migration(s) reverted\n", len(reverted))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			panic(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedDtm != nil {
+				state = "applied " + s.AppliedDtm.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	}
+}
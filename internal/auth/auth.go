@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/response"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	//ProtocolAccessToken is the Sec-WebSocket-Protocol marker, browser clients send "access_token, <jwt>"
+	ProtocolAccessToken = "access_token"
+	queryToken          = "token"
+	bearerPrefix        = "Bearer "
+	defaultUsernameKey  = "sub"
+)
+
+var (
+	ErrMissingToken = errors.New("missing token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+type ctxKey struct{}
+
+type Authenticator interface {
+	//Authenticate verifies the request credential and returns the username taken from verified claims
+	Authenticate(r *http.Request) (string, error)
+}
+
+type jwtAuthenticator struct {
+	method      jwt.SigningMethod
+	key         interface{}
+	issuer      string
+	audience    string
+	usernameKey string
+}
+
+func NewJWT(env config.Env) (Authenticator, error) {
+	method := jwt.GetSigningMethod(env.JwtAlg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported jwt algorithm: %q", env.JwtAlg)
+	}
+	key, err := loadKey(method, env)
+	if err != nil {
+		return nil, err
+	}
+
+	usernameKey := env.JwtUsernameClaim
+	if usernameKey == "" {
+		usernameKey = defaultUsernameKey
+	}
+	return &jwtAuthenticator{
+		method:      method,
+		key:         key,
+		issuer:      env.JwtIssuer,
+		audience:    env.JwtAudience,
+		usernameKey: usernameKey,
+	}, nil
+}
+
+func (a jwtAuthenticator) Authenticate(r *http.Request) (string, error) {
+	raw := extractToken(r)
+	if raw == "" {
+		return "", ErrMissingToken
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		//never let the token choose its own algorithm
+		if t.Method.Alg() != a.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Method.Alg())
+		}
+		return a.key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	//parser checks exp only when present, a token without it would never expire
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", fmt.Errorf("%w: exp is required", ErrInvalidToken)
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return "", fmt.Errorf("%w: issuer mismatch", ErrInvalidToken)
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return "", fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+	}
+
+	username, _ := claims[a.usernameKey].(string)
+	if username == "" {
+		return "", fmt.Errorf("%w: claim %s not found", ErrInvalidToken, a.usernameKey)
+	}
+	return username, nil
+}
+
+// Middleware rejects unauthenticated rest request and stores username in request context
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, err := a.Authenticate(r)
+			if err != nil {
+				response.Error(w, StatusCode(err), http.StatusText(StatusCode(err)))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, username)))
+		})
+	}
+}
+
+// Username returns authenticated username stored by Middleware
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(ctxKey{}).(string)
+	return username
+}
+
+// StatusCode maps authentication error to http status
+func StatusCode(err error) int {
+	if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, ErrMissingToken) || errors.Is(err, ErrInvalidToken) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// extractToken looks for the token in Authorization header, Sec-WebSocket-Protocol and then query string
+func extractToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, bearerPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(h, bearerPrefix))
+	}
+
+	var protocols []string
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			protocols = append(protocols, strings.TrimSpace(p))
+		}
+	}
+	for i, p := range protocols {
+		if p == ProtocolAccessToken && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return r.URL.Query().Get(queryToken)
+}
+
+func loadKey(method jwt.SigningMethod, env config.Env) (interface{}, error) {
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if env.JwtSecret == "" {
+			return nil, errors.New("JWT_SECRET is required for hmac algorithm")
+		}
+		return []byte(env.JwtSecret), nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		if env.JwtPublicKey == "" {
+			return nil, errors.New("JWT_PUBLIC_KEY is required for rsa/ecdsa algorithm")
+		}
+		pem, err := os.ReadFile(env.JwtPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		var key crypto.PublicKey
+		if _, ok := method.(*jwt.SigningMethodECDSA); ok {
+			key, err = jwt.ParseECPublicKeyFromPEM(pem)
+		} else {
+			key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		}
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm: %q", method.Alg())
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"chat-session/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, secret string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func Test_Authenticate(t *testing.T) {
+	env := config.Env{JwtAlg: "HS256", JwtSecret: "secret", JwtIssuer: "chat"}
+	a, err := NewJWT(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := sign(t, "secret", jwt.MapClaims{"sub": "uefa", "iss": "chat", "exp": time.Now().Add(time.Minute).Unix()})
+	tt := []struct {
+		name             string
+		req              func() *http.Request
+		expectedUsername string
+		expectedStatus   int
+	}{
+		{
+			name: "should return username when bearer token is valid",
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/online", nil)
+				r.Header.Set("Authorization", "Bearer "+valid)
+				return r
+			},
+			expectedUsername: "uefa",
+		},
+		{
+			name: "should return username when token is passed as websocket protocol",
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/online", nil)
+				r.Header.Set("Sec-WebSocket-Protocol", ProtocolAccessToken+", "+valid)
+				return r
+			},
+			expectedUsername: "uefa",
+		},
+		{
+			name: "should return username when token is passed as query string",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/online?token="+valid, nil)
+			},
+			expectedUsername: "uefa",
+		},
+		{
+			name: "should return unauthorized when token is missing",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/online", nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "should return unauthorized when token is signed with another secret",
+			req: func() *http.Request {
+				token := sign(t, "other", jwt.MapClaims{"sub": "uefa", "iss": "chat"})
+				return httptest.NewRequest(http.MethodGet, "/online?token="+token, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "should return unauthorized when token is expired",
+			req: func() *http.Request {
+				token := sign(t, "secret", jwt.MapClaims{"sub": "uefa", "iss": "chat", "exp": time.Now().Add(-time.Minute).Unix()})
+				return httptest.NewRequest(http.MethodGet, "/online?token="+token, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "should return unauthorized when token has no expiry",
+			req: func() *http.Request {
+				token := sign(t, "secret", jwt.MapClaims{"sub": "uefa", "iss": "chat"})
+				return httptest.NewRequest(http.MethodGet, "/online?token="+token, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "should return unauthorized when issuer mismatch",
+			req: func() *http.Request {
+				token := sign(t, "secret", jwt.MapClaims{"sub": "uefa", "iss": "other", "exp": time.Now().Add(time.Minute).Unix()})
+				return httptest.NewRequest(http.MethodGet, "/online?token="+token, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			username, err := a.Authenticate(tc.req())
+			assert.Equal(t, tc.expectedUsername, username)
+			if tc.expectedStatus != 0 {
+				assert.Equal(t, tc.expectedStatus, StatusCode(err))
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
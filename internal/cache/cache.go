@@ -3,52 +3,374 @@ package cache
 import (
 	"chat-session/internal/config"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/go-redis/redis/v8"
+	"net"
+	"strings"
 	"time"
 )
 
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+)
+
+var (
+	//ErrNil is returned when key does not exist
+	ErrNil = errors.New("cache: nil")
+	//ErrUnsupported is returned by backend that cannot serve the operation
+	ErrUnsupported = errors.New("cache: operation not supported by backend")
+)
+
+// Message is one payload received from a channel
+type Message struct {
+	Channel string
+	Payload string
+}
+
+type Subscription interface {
+	//Receive waits up to timeout, nil message without error means nothing arrived
+	Receive(ctx context.Context, timeout time.Duration) (*Message, error)
+	Close() error
+}
+
+// StreamEntry is one entry read from stream by consumer group
+type StreamEntry struct {
+	Id      string
+	Payload string
+}
+
 type Cache interface {
-	Set(key, val string, ttl ...time.Duration) error
-	Get(key string) (string, error)
-	Del(key string) error
-	Pub(channel, msg string) *redis.IntCmd
-	Sub(channel string) *redis.PubSub
+	Set(ctx context.Context, key, val string, ttl ...time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+	//SetNX sets key only when it does not exist yet and reports whether it was set
+	SetNX(ctx context.Context, key, val string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, key string) error
+	HSet(ctx context.Context, key string, values map[string]string, ttl ...time.Duration) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HIncrBy(ctx context.Context, key, field string, incr int64) error
+	//HIncrByIfExists increments field only when hash already has guard field, it reports whether it incremented
+	HIncrByIfExists(ctx context.Context, key, guard, field string, incr int64) (bool, error)
+	//HSetIfEqual sets values and refreshes expiry only when field holds expected, it reports whether it set
+	HSetIfEqual(ctx context.Context, key, field, expected string, values map[string]string, ttl ...time.Duration) (bool, error)
+	SAdd(ctx context.Context, key, member string, ttl ...time.Duration) error
+	SRem(ctx context.Context, key, member string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+	ZAdd(ctx context.Context, key, member string, score float64, ttl ...time.Duration) error
+	ZRem(ctx context.Context, key, member string) error
+	ZCount(ctx context.Context, key, min, max string) (int64, error)
+	ZRemRangeByScore(ctx context.Context, key, min, max string) error
+	//Pub returns number of subscribers that received msg
+	Pub(ctx context.Context, channel, msg string) (int64, error)
+	Sub(ctx context.Context, channel string) (Subscription, error)
+	XAdd(ctx context.Context, stream, payload string, maxLen int64) (string, error)
+	XGroupCreate(ctx context.Context, stream, group, start string) error
+	XReadGroup(ctx context.Context, stream, group, consumer, id string, count int64, block time.Duration) ([]StreamEntry, error)
+	XAck(ctx context.Context, stream, group, id string) error
+	XGroupDestroy(ctx context.Context, stream, group string) error
+	//XGroupCount returns number of consumer groups of stream, missing stream has none
+	XGroupCount(ctx context.Context, stream string) (int64, error)
 }
 
 type cache struct {
-	rdb *redis.Client
-	env config.Env
+	rdb     *redis.Client
+	env     config.Env
+	timeout time.Duration
+}
+
+func NewCache(rdb *redis.Client, env config.Env) (Cache, error) {
+	switch env.CacheBackend {
+	case "", BackendRedis:
+		return &cache{
+			rdb:     rdb,
+			env:     env,
+			timeout: time.Duration(env.RedisTimeout) * time.Millisecond,
+		}, nil
+	case BackendMemory:
+		//memory backend has no streams and is not shared between instances
+		if env.DeliveryBackend == "stream" {
+			return nil, errors.New("stream delivery backend requires redis cache")
+		}
+		return NewMemory(env), nil
+	}
+	return nil, fmt.Errorf("unsupported cache backend: %q", env.CacheBackend)
 }
 
-func NewCache(rdb *redis.Client, env config.Env) Cache {
-	return &cache{
-		rdb: rdb,
-		env: env,
+// withTimeout bounds one redis operation, zero timeout leaves ctx as is
+func (c cache) withTimeout(ctx context.Context, extra time.Duration) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, c.timeout+extra)
 }
 
-func (c cache) Set(key, val string, ttl ...time.Duration) error {
+func (c cache) Set(ctx context.Context, key, val string, ttl ...time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
 	exp := time.Duration(c.env.RedisTTL) * time.Millisecond
 	if len(ttl) > 0 {
 		exp = ttl[0]
 	}
-	_, err := c.rdb.SetEX(context.Background(), key, val, exp).Result()
+	//zero ttl keeps the key without expiry
+	_, err := c.rdb.Set(ctx, key, val, exp).Result()
 	return err
 }
 
-func (c cache) Get(key string) (string, error) {
-	return c.rdb.Get(context.Background(), key).Result()
+func (c cache) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	v, err := c.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrNil
+	}
+	return v, err
+}
+
+func (c cache) SetNX(ctx context.Context, key, val string, ttl time.Duration) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.SetNX(ctx, key, val, ttl).Result()
+}
+
+func (c cache) Del(ctx context.Context, key string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	_, err := c.rdb.Del(ctx, key).Result()
+	return err
 }
 
-func (c cache) Del(key string) error {
-	_, err := c.rdb.Del(context.Background(), key).Result()
+func (c cache) HSet(ctx context.Context, key string, values map[string]string, ttl ...time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	exp := time.Duration(c.env.RedisTTL) * time.Millisecond
+	if len(ttl) > 0 {
+		exp = ttl[0]
+	}
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, values)
+		pipe.Expire(ctx, key, exp)
+		return nil
+	})
 	return err
 }
 
-func (c cache) Pub(channel, msg string) *redis.IntCmd {
-	return c.rdb.Publish(context.Background(), channel, msg)
+func (c cache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.HGetAll(ctx, key).Result()
+}
+
+func (c cache) HIncrBy(ctx context.Context, key, field string, incr int64) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	_, err := c.rdb.HIncrBy(ctx, key, field, incr).Result()
+	return err
+}
+
+var hIncrByIfExists = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+func (c cache) HIncrByIfExists(ctx context.Context, key, guard, field string, incr int64) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	n, err := hIncrByIfExists.Run(ctx, c.rdb, []string{key}, guard, field, incr).Int()
+	return n == 1, err
+}
+
+var hSetIfEqual = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+func (c cache) HSetIfEqual(ctx context.Context, key, field, expected string, values map[string]string, ttl ...time.Duration) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	exp := time.Duration(c.env.RedisTTL) * time.Millisecond
+	if len(ttl) > 0 {
+		exp = ttl[0]
+	}
+	args := []interface{}{field, expected, exp.Milliseconds()}
+	for f, v := range values {
+		args = append(args, f, v)
+	}
+	n, err := hSetIfEqual.Run(ctx, c.rdb, []string{key}, args...).Int()
+	return n == 1, err
+}
+
+// SAdd adds member into set and refreshes expiry of the whole set
+func (c cache) SAdd(ctx context.Context, key, member string, ttl ...time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	exp := time.Duration(c.env.RedisTTL) * time.Millisecond
+	if len(ttl) > 0 {
+		exp = ttl[0]
+	}
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, member)
+		pipe.Expire(ctx, key, exp)
+		return nil
+	})
+	return err
+}
+
+func (c cache) SRem(ctx context.Context, key, member string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	_, err := c.rdb.SRem(ctx, key, member).Result()
+	return err
 }
 
-func (c cache) Sub(channel string) *redis.PubSub {
-	return c.rdb.Subscribe(context.Background(), channel)
+func (c cache) SMembers(ctx context.Context, key string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.SMembers(ctx, key).Result()
+}
+
+// ZAdd adds or updates member score and refreshes expiry of the whole sorted set
+func (c cache) ZAdd(ctx context.Context, key, member string, score float64, ttl ...time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	exp := time.Duration(c.env.RedisTTL) * time.Millisecond
+	if len(ttl) > 0 {
+		exp = ttl[0]
+	}
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, &redis.Z{Score: score, Member: member})
+		pipe.Expire(ctx, key, exp)
+		return nil
+	})
+	return err
+}
+
+func (c cache) ZRem(ctx context.Context, key, member string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	_, err := c.rdb.ZRem(ctx, key, member).Result()
+	return err
+}
+
+func (c cache) ZCount(ctx context.Context, key, min, max string) (int64, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.ZCount(ctx, key, min, max).Result()
+}
+
+func (c cache) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	_, err := c.rdb.ZRemRangeByScore(ctx, key, min, max).Result()
+	return err
+}
+
+func (c cache) Pub(ctx context.Context, channel, msg string) (int64, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.Publish(ctx, channel, msg).Result()
+}
+
+func (c cache) Sub(ctx context.Context, channel string) (Subscription, error) {
+	return &subscription{ps: c.rdb.Subscribe(ctx, channel)}, nil
+}
+
+type subscription struct {
+	ps *redis.PubSub
+}
+
+func (s subscription) Receive(ctx context.Context, timeout time.Duration) (*Message, error) {
+	msg, err := s.ps.ReceiveTimeout(ctx, timeout)
+	if _, ok := err.(*net.OpError); ok {
+		//timeout here
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := msg.(*redis.Message); ok {
+		return &Message{Channel: m.Channel, Payload: m.Payload}, nil
+	}
+	//subscription confirmation and pong
+	return nil, nil
+}
+
+func (s subscription) Close() error {
+	return s.ps.Close()
+}
+
+// XAdd appends payload to stream, stream is trimmed approximately to maxLen
+func (c cache) XAdd(ctx context.Context, stream, payload string, maxLen int64) (string, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": payload},
+	}).Result()
+}
+
+// XGroupCreate creates consumer group and the stream if needed, existing group is not an error
+func (c cache) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	err := c.rdb.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+func (c cache) XReadGroup(ctx context.Context, stream, group, consumer, id string, count int64, block time.Duration) ([]StreamEntry, error) {
+	ctx, cancel := c.withTimeout(ctx, block)
+	defer cancel()
+	streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, id},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	entries := make([]StreamEntry, 0, len(streams[0].Messages))
+	for _, m := range streams[0].Messages {
+		payload, _ := m.Values["payload"].(string)
+		entries = append(entries, StreamEntry{Id: m.ID, Payload: payload})
+	}
+	return entries, nil
+}
+
+func (c cache) XAck(ctx context.Context, stream, group, id string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.XAck(ctx, stream, group, id).Err()
+}
+
+func (c cache) XGroupDestroy(ctx context.Context, stream, group string) error {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	return c.rdb.XGroupDestroy(ctx, stream, group).Err()
+}
+
+func (c cache) XGroupCount(ctx context.Context, stream string) (int64, error) {
+	ctx, cancel := c.withTimeout(ctx, 0)
+	defer cancel()
+	groups, err := c.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil && strings.HasPrefix(err.Error(), "ERR no such key") {
+		return 0, nil
+	}
+	return int64(len(groups)), err
 }
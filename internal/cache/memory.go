@@ -0,0 +1,481 @@
+package cache
+
+import (
+	"chat-session/internal/config"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//memSubBuffer is how many messages a slow subscriber may lag behind before new ones are dropped for it
+	memSubBuffer = 256
+	//memSweepInterval is how often writes also evict every expired key, reads evict lazily
+	memSweepInterval = time.Minute
+)
+
+var (
+	errWrongType          = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSubscriptionClosed = errors.New("cache: subscription closed")
+)
+
+// entry holds exactly one of the value kinds, zero expireAt means no expiry
+type entry struct {
+	str      *string
+	hash     map[string]string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// memory keeps everything inside the process, it is meant for a single instance and tests, streams are not supported
+type memory struct {
+	mu        sync.Mutex
+	env       config.Env
+	items     map[string]*entry
+	channels  map[string]map[*memSubscription]struct{}
+	lastSweep time.Time
+}
+
+func NewMemory(env config.Env) Cache {
+	return &memory{
+		env:       env,
+		items:     make(map[string]*entry),
+		channels:  make(map[string]map[*memSubscription]struct{}),
+		lastSweep: time.Now(),
+	}
+}
+
+// ttlOf mirrors redis default ttl, zero or negative ttl keeps the key without expiry
+func (m *memory) ttlOf(ttl []time.Duration) time.Time {
+	exp := time.Duration(m.env.RedisTTL) * time.Millisecond
+	if len(ttl) > 0 {
+		exp = ttl[0]
+	}
+	if exp <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(exp)
+}
+
+// lookup returns live entry of key, caller holds mu
+func (m *memory) lookup(key string) *entry {
+	e, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(time.Now()) {
+		delete(m.items, key)
+		return nil
+	}
+	return e
+}
+
+// sweep evicts expired keys at most once per interval, caller holds mu
+func (m *memory) sweep() {
+	now := time.Now()
+	if now.Sub(m.lastSweep) < memSweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, e := range m.items {
+		if e.expired(now) {
+			delete(m.items, key)
+		}
+	}
+}
+
+func (m *memory) Set(_ context.Context, key, val string, ttl ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	m.items[key] = &entry{str: &val, expireAt: m.ttlOf(ttl)}
+	return nil
+}
+
+func (m *memory) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		return "", ErrNil
+	}
+	if e.str == nil {
+		return "", errWrongType
+	}
+	return *e.str, nil
+}
+
+func (m *memory) SetNX(_ context.Context, key, val string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	if m.lookup(key) != nil {
+		return false, nil
+	}
+	m.items[key] = &entry{str: &val, expireAt: m.ttlOf([]time.Duration{ttl})}
+	return true, nil
+}
+
+func (m *memory) Del(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+func (m *memory) HSet(_ context.Context, key string, values map[string]string, ttl ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	e, err := m.hash(key)
+	if err != nil {
+		return err
+	}
+	for field, v := range values {
+		e.hash[field] = v
+	}
+	e.expireAt = m.ttlOf(ttl)
+	return nil
+}
+
+func (m *memory) HGetAll(_ context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		return map[string]string{}, nil
+	}
+	if e.hash == nil {
+		return nil, errWrongType
+	}
+	values := make(map[string]string, len(e.hash))
+	for field, v := range e.hash {
+		values[field] = v
+	}
+	return values, nil
+}
+
+// HIncrBy keeps expiry of existing hash like redis does
+func (m *memory) HIncrBy(_ context.Context, key, field string, incr int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	e, err := m.hash(key)
+	if err != nil {
+		return err
+	}
+	return e.hincr(field, incr)
+}
+
+// hincr adds incr to integer field of hash entry, caller holds mu
+func (e *entry) hincr(field string, incr int64) error {
+	n := int64(0)
+	if v, ok := e.hash[field]; ok {
+		var err error
+		n, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	e.hash[field] = strconv.FormatInt(n+incr, 10)
+	return nil
+}
+
+func (m *memory) HIncrByIfExists(_ context.Context, key, guard, field string, incr int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil || e.hash == nil {
+		return false, nil
+	}
+	if _, ok := e.hash[guard]; !ok {
+		return false, nil
+	}
+	return true, e.hincr(field, incr)
+}
+
+func (m *memory) HSetIfEqual(_ context.Context, key, field, expected string, values map[string]string, ttl ...time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	e := m.lookup(key)
+	if e == nil || e.hash == nil || e.hash[field] != expected {
+		return false, nil
+	}
+	for f, v := range values {
+		e.hash[f] = v
+	}
+	e.expireAt = m.ttlOf(ttl)
+	return true, nil
+}
+
+// hash returns hash entry of key and creates it when missing, caller holds mu
+func (m *memory) hash(key string) (*entry, error) {
+	e := m.lookup(key)
+	if e == nil {
+		e = &entry{hash: make(map[string]string)}
+		m.items[key] = e
+	}
+	if e.hash == nil {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// SAdd adds member into set and refreshes expiry of the whole set
+func (m *memory) SAdd(_ context.Context, key, member string, ttl ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	e := m.lookup(key)
+	if e == nil {
+		e = &entry{set: make(map[string]struct{})}
+		m.items[key] = e
+	}
+	if e.set == nil {
+		return errWrongType
+	}
+	e.set[member] = struct{}{}
+	e.expireAt = m.ttlOf(ttl)
+	return nil
+}
+
+func (m *memory) SRem(_ context.Context, key, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		return nil
+	}
+	if e.set == nil {
+		return errWrongType
+	}
+	delete(e.set, member)
+	//redis removes empty set
+	if len(e.set) == 0 {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *memory) SMembers(_ context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		return []string{}, nil
+	}
+	if e.set == nil {
+		return nil, errWrongType
+	}
+	members := make([]string, 0, len(e.set))
+	for member := range e.set {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// ZAdd adds or updates member score and refreshes expiry of the whole sorted set
+func (m *memory) ZAdd(_ context.Context, key, member string, score float64, ttl ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	e := m.lookup(key)
+	if e == nil {
+		e = &entry{zset: make(map[string]float64)}
+		m.items[key] = e
+	}
+	if e.zset == nil {
+		return errWrongType
+	}
+	e.zset[member] = score
+	e.expireAt = m.ttlOf(ttl)
+	return nil
+}
+
+func (m *memory) ZRem(_ context.Context, key, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.lookup(key)
+	if e == nil {
+		return nil
+	}
+	if e.zset == nil {
+		return errWrongType
+	}
+	delete(e.zset, member)
+	if len(e.zset) == 0 {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *memory) ZCount(_ context.Context, key, min, max string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inRange, err := scoreRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+	e := m.lookup(key)
+	if e == nil {
+		return 0, nil
+	}
+	if e.zset == nil {
+		return 0, errWrongType
+	}
+	n := int64(0)
+	for _, score := range e.zset {
+		if inRange(score) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memory) ZRemRangeByScore(_ context.Context, key, min, max string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inRange, err := scoreRange(min, max)
+	if err != nil {
+		return err
+	}
+	e := m.lookup(key)
+	if e == nil {
+		return nil
+	}
+	if e.zset == nil {
+		return errWrongType
+	}
+	for member, score := range e.zset {
+		if inRange(score) {
+			delete(e.zset, member)
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+// scoreRange parses redis score bounds, "(" prefix makes the bound exclusive and -inf/+inf are accepted
+func scoreRange(min, max string) (func(float64) bool, error) {
+	lo, loOpen, err := parseScore(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, hiOpen, err := parseScore(max)
+	if err != nil {
+		return nil, err
+	}
+	return func(score float64) bool {
+		if score < lo || (loOpen && score == lo) {
+			return false
+		}
+		return score < hi || (!hiOpen && score == hi)
+	}, nil
+}
+
+func parseScore(s string) (float64, bool, error) {
+	open := strings.HasPrefix(s, "(")
+	f, err := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return f, open, nil
+}
+
+// Pub never blocks, subscriber whose buffer is full misses the message and is not counted
+func (m *memory) Pub(_ context.Context, channel, msg string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := int64(0)
+	for sub := range m.channels[channel] {
+		select {
+		case sub.ch <- Message{Channel: channel, Payload: msg}:
+			n++
+		default:
+		}
+	}
+	return n, nil
+}
+
+func (m *memory) Sub(_ context.Context, channel string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub := &memSubscription{m: m, channel: channel, ch: make(chan Message, memSubBuffer)}
+	if m.channels[channel] == nil {
+		m.channels[channel] = make(map[*memSubscription]struct{})
+	}
+	m.channels[channel][sub] = struct{}{}
+	return sub, nil
+}
+
+func (m *memory) XAdd(context.Context, string, string, int64) (string, error) {
+	return "", ErrUnsupported
+}
+
+func (m *memory) XGroupCreate(context.Context, string, string, string) error {
+	return ErrUnsupported
+}
+
+func (m *memory) XReadGroup(context.Context, string, string, string, string, int64, time.Duration) ([]StreamEntry, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *memory) XAck(context.Context, string, string, string) error {
+	return ErrUnsupported
+}
+
+func (m *memory) XGroupDestroy(context.Context, string, string) error {
+	return ErrUnsupported
+}
+
+func (m *memory) XGroupCount(context.Context, string) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+type memSubscription struct {
+	m       *memory
+	channel string
+	ch      chan Message
+	once    sync.Once
+}
+
+func (s *memSubscription) Receive(ctx context.Context, timeout time.Duration) (*Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-s.ch:
+		if !ok {
+			return nil, errSubscriptionClosed
+		}
+		return &msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// Close unregisters subscription before closing its channel so Pub never sends on a closed channel
+func (s *memSubscription) Close() error {
+	s.once.Do(func() {
+		s.m.mu.Lock()
+		defer s.m.mu.Unlock()
+		delete(s.m.channels[s.channel], s)
+		if len(s.m.channels[s.channel]) == 0 {
+			delete(s.m.channels, s.channel)
+		}
+		close(s.ch)
+	})
+	return nil
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"chat-session/internal/config"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_memoryGet(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(config.Env{RedisTTL: 60000})
+	_ = c.Set(ctx, "live", "v")
+	_ = c.Set(ctx, "expired", "v", time.Millisecond)
+	_ = c.Set(ctx, "forever", "v", 0)
+	_ = c.SAdd(ctx, "set", "m")
+	time.Sleep(5 * time.Millisecond)
+
+	tt := []struct {
+		name        string
+		key         string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "should return value when key is live",
+			key:      "live",
+			expected: "v",
+		},
+		{
+			name:     "should keep key when ttl is zero",
+			key:      "forever",
+			expected: "v",
+		},
+		{
+			name:        "should return nil error when key is expired",
+			key:         "expired",
+			expectedErr: ErrNil,
+		},
+		{
+			name:        "should return nil error when key is not found",
+			key:         "missing",
+			expectedErr: ErrNil,
+		},
+		{
+			name:        "should return wrong type when key is not a string",
+			key:         "set",
+			expectedErr: errWrongType,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := c.Get(ctx, tc.key)
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+}
+
+func Test_memorySetNX(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(config.Env{RedisTTL: 60000})
+
+	ok, err := c.SetNX(ctx, "k", "a", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = c.SetNX(ctx, "k", "b", time.Minute)
+	assert.False(t, ok)
+	v, _ := c.Get(ctx, "k")
+	assert.Equal(t, "a", v)
+
+	//expired key can be claimed again
+	time.Sleep(5 * time.Millisecond)
+	ok, _ = c.SetNX(ctx, "k", "b", time.Minute)
+	assert.True(t, ok)
+}
+
+func Test_memoryZCount(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(config.Env{RedisTTL: 60000})
+	_ = c.ZAdd(ctx, "z", "a", 1)
+	_ = c.ZAdd(ctx, "z", "b", 2)
+	_ = c.ZAdd(ctx, "z", "c", 3)
+
+	tt := []struct {
+		name     string
+		min      string
+		max      string
+		expected int64
+	}{
+		{
+			name:     "should count every member when range is infinite",
+			min:      "-inf",
+			max:      "+inf",
+			expected: 3,
+		},
+		{
+			name:     "should include both bounds",
+			min:      "2",
+			max:      "3",
+			expected: 2,
+		},
+		{
+			name:     "should exclude bound when prefixed with parenthesis",
+			min:      "(2",
+			max:      "+inf",
+			expected: 1,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := c.ZCount(ctx, "z", tc.min, tc.max)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, n)
+		})
+	}
+
+	assert.Nil(t, c.ZRemRangeByScore(ctx, "z", "-inf", "2"))
+	n, _ := c.ZCount(ctx, "z", "-inf", "+inf")
+	assert.Equal(t, int64(1), n)
+}
+
+func Test_memoryPubSub(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(config.Env{})
+	sub, err := c.Sub(ctx, "ch")
+	assert.Nil(t, err)
+
+	n, err := c.Pub(ctx, "ch", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	msg, err := sub.Receive(ctx, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Channel: "ch", Payload: "hello"}, msg)
+
+	//nothing published, receive times out without error
+	msg, err = sub.Receive(ctx, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, msg)
+
+	assert.Nil(t, sub.Close())
+	n, _ = c.Pub(ctx, "ch", "hello")
+	assert.Equal(t, int64(0), n)
+	_, err = sub.Receive(ctx, time.Millisecond)
+	assert.Equal(t, errSubscriptionClosed, err)
+}
+
+func Test_NewCache(t *testing.T) {
+	tt := []struct {
+		name        string
+		env         config.Env
+		expectedErr bool
+	}{
+		{
+			name: "should create memory cache when backend is memory",
+			env:  config.Env{CacheBackend: BackendMemory, DeliveryBackend: "pubsub"},
+		},
+		{
+			name:        "should return error when memory cache is used with stream delivery",
+			env:         config.Env{CacheBackend: BackendMemory, DeliveryBackend: "stream"},
+			expectedErr: true,
+		},
+		{
+			name:        "should return error when backend is unknown",
+			env:         config.Env{CacheBackend: "memcached"},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCache(nil, tc.env)
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+}
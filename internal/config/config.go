@@ -8,9 +8,13 @@ import (
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	_ "modernc.org/sqlite"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -22,6 +26,10 @@ type Cfg struct {
 
 type Env struct {
 	Port                string `env:"PORT"`
+	DBDriver            string `env:"DB_DRIVER" envDefault:"mysql"`
+	PostgresUrl         string `env:"POSTGRES_URL"`
+	SQLitePath          string `env:"SQLITE_PATH" envDefault:"./chat.db"`
+	MigrateOnStart      bool   `env:"MIGRATE_ON_START" envDefault:"true"`
 	MySqlUser           string `env:"MYSQL_USER"`
 	MySqlPwd            string `env:"MYSQL_PWD"`
 	MySqlUrl            string `env:"MYSQL_URL"`
@@ -29,17 +37,55 @@ type Env struct {
 	MySqlMaxOpenCon     int    `env:"MYSQL_MAX_OPEN_CON"`
 	MySqlMaxIdleCon     int    `env:"MYSQL_MAX_IDLE_CON"`
 	MySqlConMaxLifetime int    `env:"MYSQL_CON_MAX_LIFETIME"`
+	CacheBackend        string `env:"CACHE_BACKEND" envDefault:"redis"`
 	RedisAddr           string `env:"REDIS_ADDR"`
 	RedisTTL            int    `env:"REDIS_TTL"`
+	RedisTimeout        int    `env:"REDIS_TIMEOUT" envDefault:"1000"`
+	DBTimeout           int    `env:"DB_TIMEOUT" envDefault:"3000"`
+	ShutdownTimeout     int    `env:"SHUTDOWN_TIMEOUT" envDefault:"10000"`
+	OutboundQueueSize   int    `env:"OUTBOUND_QUEUE_SIZE" envDefault:"256"`
+	OutboundOverflow    string `env:"OUTBOUND_OVERFLOW" envDefault:"drop_oldest"`
+	WriteTimeout        int    `env:"WRITE_TIMEOUT" envDefault:"10000"`
+	JwtAlg              string `env:"JWT_ALG" envDefault:"HS256"`
+	JwtSecret           string `env:"JWT_SECRET"`
+	JwtPublicKey        string `env:"JWT_PUBLIC_KEY"`
+	JwtIssuer           string `env:"JWT_ISSUER"`
+	JwtAudience         string `env:"JWT_AUDIENCE"`
+	JwtUsernameClaim    string `env:"JWT_USERNAME_CLAIM" envDefault:"sub"`
+	HeartbeatInterval   int    `env:"HEARTBEAT_INTERVAL" envDefault:"15000"`
+	HeartbeatTimeout    int    `env:"HEARTBEAT_TIMEOUT" envDefault:"45000"`
+	TypingExpiry        int    `env:"TYPING_EXPIRY" envDefault:"5000"`
+	TypingThrottle      int    `env:"TYPING_THROTTLE" envDefault:"1000"`
+	TypingRateLimit     int    `env:"TYPING_RATE_LIMIT" envDefault:"10"`
+	TypingMaxTargets    int    `env:"TYPING_MAX_TARGETS" envDefault:"20"`
+	DeliveryBackend     string `env:"DELIVERY_BACKEND" envDefault:"pubsub"`
+	StreamMaxLen        int64  `env:"STREAM_MAX_LEN" envDefault:"1000"`
+	WritePath           string `env:"WRITE_PATH" envDefault:"publish_first"`
+	OutboxPollInterval  int    `env:"OUTBOX_POLL_INTERVAL" envDefault:"500"`
+	OutboxBatchSize     int    `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	OutboxMaxAttempts   int    `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"10"`
+	OutboxBackoff       int    `env:"OUTBOX_BACKOFF" envDefault:"1000"`
+	OutboxMaxBackoff    int    `env:"OUTBOX_MAX_BACKOFF" envDefault:"60000"`
+	OutboxRetention     int    `env:"OUTBOX_RETENTION" envDefault:"86400000"`
+	OutboxPurgeInterval int    `env:"OUTBOX_PURGE_INTERVAL" envDefault:"600000"`
 }
 
 func InitConfig() Cfg {
+	cfg := InitDBConfig()
+	//memory cache runs inside the process, no redis connection is needed
+	if cfg.Env.CacheBackend != "memory" {
+		cfg.RDB = initRDB(cfg.Env)
+	}
+	return cfg
+}
+
+// InitDBConfig connects database only, used by tooling such as migrate which does not need redis
+func InitDBConfig() Cfg {
 	localEnv := initEnv()
 	initDB(localEnv)
 	initLogs()
 	return Cfg{
 		DB:  initDBCon(localEnv),
-		RDB: initRDB(localEnv),
 		Env: localEnv,
 	}
 }
@@ -58,10 +104,21 @@ func initEnv() Env {
 		panic(err)
 	}
 
+	//unknown driver would otherwise connect as mysql and fail later on the first query
+	switch localEnv.DBDriver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		panic(fmt.Errorf("unsupported DB_DRIVER: %q", localEnv.DBDriver))
+	}
+
 	return localEnv
 }
 
 func initDB(env Env) {
+	//postgres has no create database if not exists, database is provisioned with the instance, sqlite creates the file on open
+	if env.DBDriver != "mysql" {
+		return
+	}
 	url := fmt.Sprintf("%v:%v@tcp(%v)/", env.MySqlUser, env.MySqlPwd, env.MySqlUrl)
 	conn, err := sql.Open("mysql", url)
 	if err != nil {
@@ -86,15 +143,28 @@ func initDB(env Env) {
 }
 
 func initDBCon(env Env) *sql.DB {
-	url := fmt.Sprintf("%v:%v@tcp(%v)/%v?parseTime=true&loc=Local", env.MySqlUser, env.MySqlPwd, env.MySqlUrl, env.MysqlDbName)
-	fmt.Printf("start connect: %v\n", url)
-	conn, err := sql.Open("mysql", url)
+	driver, url := "mysql", fmt.Sprintf("%v:%v@tcp(%v)/%v?parseTime=true&loc=UTC", env.MySqlUser, env.MySqlPwd, env.MySqlUrl, env.MysqlDbName)
+	switch env.DBDriver {
+	case "postgres":
+		driver, url = "postgres", env.PostgresUrl
+	case "sqlite":
+		//wait on lock instead of failing with SQLITE_BUSY, WAL lets readers run beside the writer
+		driver, url = "sqlite", fmt.Sprintf("file:%v?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", env.SQLitePath)
+	}
+	//url carries the password, only the host is printed
+	fmt.Printf("start connect %v: %v\n", driver, dbHost(env))
+	conn, err := sql.Open(driver, url)
 	if err != nil {
 		panic(err)
 	}
-	conn.SetMaxOpenConns(env.MySqlMaxOpenCon)
-	conn.SetMaxIdleConns(env.MySqlMaxIdleCon)
-	conn.SetConnMaxLifetime(time.Duration(env.MySqlConMaxLifetime) * time.Millisecond)
+	if driver == "sqlite" {
+		//sqlite allows a single writer, one connection serializes writes inside the process
+		conn.SetMaxOpenConns(1)
+	} else {
+		conn.SetMaxOpenConns(env.MySqlMaxOpenCon)
+		conn.SetMaxIdleConns(env.MySqlMaxIdleCon)
+		conn.SetConnMaxLifetime(time.Duration(env.MySqlConMaxLifetime) * time.Millisecond)
+	}
 
 	//check db health
 	err = conn.Ping()
@@ -105,6 +175,27 @@ func initDBCon(env Env) *sql.DB {
 	return conn
 }
 
+// dbHost returns the database host without credential, sqlite has the file path instead
+func dbHost(env Env) string {
+	switch env.DBDriver {
+	case "postgres":
+		u, err := url.Parse(env.PostgresUrl)
+		if err == nil && u.Host != "" {
+			return u.Host
+		}
+		//key value connection string may hold the password anywhere, keep it out of the log
+		for _, field := range strings.Fields(env.PostgresUrl) {
+			if strings.HasPrefix(field, "host=") {
+				return strings.TrimPrefix(field, "host=")
+			}
+		}
+		return ""
+	case "sqlite":
+		return env.SQLitePath
+	}
+	return env.MySqlUrl
+}
+
 func initRDB(env Env) *redis.Client {
 	fmt.Printf("start connect redis: %v\n", env.RedisAddr)
 	rdb := redis.NewClient(&redis.Options{
@@ -148,6 +239,9 @@ func initLogs() {
 }
 
 func (cfg *Cfg) Free() {
+	if cfg.RDB != nil {
+		_ = cfg.RDB.Close()
+	}
 	if cfg.DB != nil {
 		_ = cfg.DB.Close()
 	}
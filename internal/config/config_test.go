@@ -0,0 +1,40 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_dbHost(t *testing.T) {
+	tt := []struct {
+		name     string
+		env      Env
+		expected string
+	}{
+		{
+			name:     "should return host of mysql",
+			env:      Env{DBDriver: "mysql", MySqlUrl: "localhost:3306", MySqlPwd: "secret"},
+			expected: "localhost:3306",
+		},
+		{
+			name:     "should return host of postgres url without credential",
+			env:      Env{DBDriver: "postgres", PostgresUrl: "postgres://chat:secret@db:5432/chat?sslmode=disable"},
+			expected: "db:5432",
+		},
+		{
+			name:     "should return host of postgres key value string without credential",
+			env:      Env{DBDriver: "postgres", PostgresUrl: "user=chat password=secret host=db dbname=chat"},
+			expected: "db",
+		},
+		{
+			name:     "should return file of sqlite",
+			env:      Env{DBDriver: "sqlite", SQLitePath: "./chat.db"},
+			expected: "./chat.db",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, dbHost(tc.env))
+		})
+	}
+}
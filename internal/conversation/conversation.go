@@ -0,0 +1,129 @@
+package conversation
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/model"
+	"chat-session/internal/repository"
+	"chat-session/internal/response"
+	"chat-session/internal/unread"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+type Service interface {
+	Inbox(w http.ResponseWriter, r *http.Request)
+	Messages(w http.ResponseWriter, r *http.Request)
+}
+
+type service struct {
+	messageRepo repository.Message
+	unread      unread.Counter
+}
+
+func NewService(messageRepo repository.Message, unread unread.Counter) Service {
+	return &service{
+		messageRepo: messageRepo,
+		unread:      unread,
+	}
+}
+
+// Inbox returns every conversation of the user with its last message and unread count, newest first
+func (s service) Inbox(w http.ResponseWriter, r *http.Request) {
+	username := auth.Username(r.Context())
+
+	entities, err := s.messageRepo.FindLastMessages(r.Context(), username)
+	if err != nil {
+		zap.S().Errorf("s.messageRepo.FindLastMessages: %v", err)
+		response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	counts, err := s.unread.All(r.Context(), username)
+	if err != nil {
+		zap.S().Errorf("s.unread.All: %v", err)
+		response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	conversations := make([]model.ConversationSummary, 0, len(entities))
+	for _, entity := range entities {
+		peerId := entity.SenderId
+		if peerId == username {
+			peerId = entity.ReceiverId
+		}
+		conversations = append(conversations, model.ConversationSummary{
+			PeerId:      peerId,
+			LastMessage: toHistoryMessage(entity),
+			UnreadCount: counts[peerId],
+		})
+	}
+	response.JSON(w, http.StatusOK, conversations)
+}
+
+// Messages returns conversation history with peer using keyset pagination on message id
+func (s service) Messages(w http.ResponseWriter, r *http.Request) {
+	username := auth.Username(r.Context())
+	peer := chi.URLParam(r, "peer")
+
+	before, err := queryInt(r, "before", 0)
+	if err != nil || before < 0 {
+		response.Error(w, http.StatusBadRequest, "invalid before")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultLimit)
+	if err != nil || limit <= 0 {
+		response.Error(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	entities, err := s.messageRepo.FindConversation(r.Context(), username, peer, before, int(limit))
+	if err != nil {
+		zap.S().Errorf("s.messageRepo.FindConversation: %v", err)
+		response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	page := model.HistoryPage{Messages: make([]model.HistoryMessage, 0, len(entities))}
+	for _, entity := range entities {
+		page.Messages = append(page.Messages, toHistoryMessage(entity))
+	}
+
+	//full page means there may be older messages
+	if len(entities) == int(limit) {
+		page.NextBefore = entities[len(entities)-1].Id
+	}
+	response.JSON(w, http.StatusOK, &page)
+}
+
+func toHistoryMessage(entity repository.MessageEntity) model.HistoryMessage {
+	return model.HistoryMessage{
+		ChatMessage: model.ChatMessage{
+			Id:         entity.Id,
+			SenderId:   entity.SenderId,
+			ReceiverId: entity.ReceiverId,
+			Msg:        entity.Message,
+			SendDtm:    entity.SendDtm,
+		},
+		IsDelivered:  entity.IsDelivered,
+		IsRead:       entity.IsRead,
+		DeliveredDtm: entity.DeliveredDtm,
+		ReadDtm:      entity.ReadDtm,
+	}
+}
+
+func queryInt(r *http.Request, key string, def int64) (int64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,177 @@
+package conversation
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/model"
+	"chat-session/internal/repository"
+	"chat-session/internal/tests/mock_repository"
+	"chat-session/internal/unread"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fixedAuthenticator string
+
+func (a fixedAuthenticator) Authenticate(*http.Request) (string, error) {
+	return string(a), nil
+}
+
+func newRouter(repo repository.Message) http.Handler {
+	s := NewService(repo, unread.NewCounter(cache.NewMemory(config.Env{}), repo))
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(fixedAuthenticator("fifa")))
+	r.Get("/conversations", s.Inbox)
+	r.Get("/conversations/{peer}/messages", s.Messages)
+	return r
+}
+
+// page returns n messages with descending ids starting at top, like FindConversation does
+func page(top int64, n int) []repository.MessageEntity {
+	entities := make([]repository.MessageEntity, 0, n)
+	for i := 0; i < n; i++ {
+		entities = append(entities, repository.MessageEntity{Id: top - int64(i), SenderId: "fifa", ReceiverId: "uefa"})
+	}
+	return entities
+}
+
+func Test_Messages(t *testing.T) {
+	tt := []struct {
+		name               string
+		query              string
+		expectedBefore     int64
+		expectedLimit      int
+		found              []repository.MessageEntity
+		expectedCode       int
+		expectedNextBefore int64
+	}{
+		{
+			name:         "should reject before which is not a number",
+			query:        "?before=abc",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "should reject negative before",
+			query:        "?before=-1",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "should reject zero limit",
+			query:        "?limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "should reject limit which is not a number",
+			query:        "?limit=ten",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:          "should use default limit",
+			query:         "",
+			expectedLimit: defaultLimit,
+			found:         page(10, 3),
+			expectedCode:  http.StatusOK,
+		},
+		{
+			name:          "should cap limit at max limit",
+			query:         "?limit=500",
+			expectedLimit: maxLimit,
+			found:         page(10, 3),
+			expectedCode:  http.StatusOK,
+		},
+		{
+			name:               "should return next before on a full page",
+			query:              "?before=100&limit=3",
+			expectedBefore:     100,
+			expectedLimit:      3,
+			found:              page(99, 3),
+			expectedCode:       http.StatusOK,
+			expectedNextBefore: 97,
+		},
+		{
+			name:           "should not return next before on the last page",
+			query:          "?before=100&limit=3",
+			expectedBefore: 100,
+			expectedLimit:  3,
+			found:          page(2, 2),
+			expectedCode:   http.StatusOK,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := mock_repository.NewMockMessage(gomock.NewController(t))
+			if tc.expectedCode == http.StatusOK {
+				repo.EXPECT().FindConversation(gomock.Any(), "fifa", "uefa", tc.expectedBefore, tc.expectedLimit).Return(tc.found, nil)
+			}
+
+			w := httptest.NewRecorder()
+			newRouter(repo).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/conversations/uefa/messages"+tc.query, nil))
+			assert.Equal(t, tc.expectedCode, w.Code, w.Body.String())
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var p model.HistoryPage
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Len(t, p.Messages, len(tc.found))
+			assert.Equal(t, tc.expectedNextBefore, p.NextBefore)
+		})
+	}
+}
+
+func Test_Inbox(t *testing.T) {
+	tt := []struct {
+		name          string
+		lastErr       error
+		expectedCode  int
+		expectedPeers []string
+		expectedCount []int64
+	}{
+		{
+			name:          "should resolve peer from either side of the last message",
+			expectedCode:  http.StatusOK,
+			expectedPeers: []string{"uefa", "afc"},
+			expectedCount: []int64{0, 2},
+		},
+		{
+			name:         "should return internal server error when last messages cannot be read",
+			lastErr:      errors.New("mock err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := mock_repository.NewMockMessage(gomock.NewController(t))
+			repo.EXPECT().FindLastMessages(gomock.Any(), "fifa").Return([]repository.MessageEntity{
+				{Id: 2, SenderId: "fifa", ReceiverId: "uefa", Message: "sent"},
+				{Id: 1, SenderId: "afc", ReceiverId: "fifa", Message: "received"},
+			}, tc.lastErr)
+			if tc.lastErr == nil {
+				repo.EXPECT().CountUnread(gomock.Any(), "fifa").Return(map[string]int64{"afc": 2}, nil)
+			}
+
+			w := httptest.NewRecorder()
+			newRouter(repo).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/conversations", nil))
+			assert.Equal(t, tc.expectedCode, w.Code, w.Body.String())
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var conversations []model.ConversationSummary
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &conversations))
+			var peers []string
+			var counts []int64
+			for _, c := range conversations {
+				peers = append(peers, c.PeerId)
+				counts = append(counts, c.UnreadCount)
+			}
+			assert.Equal(t, tc.expectedPeers, peers)
+			assert.Equal(t, tc.expectedCount, counts)
+		})
+	}
+}
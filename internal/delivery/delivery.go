@@ -0,0 +1,304 @@
+package delivery
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/model"
+	"chat-session/internal/presence"
+	"chat-session/internal/repository"
+	"chat-session/internal/unread"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	RdbPublish     = "%s-channel"
+	RdbUndelivered = "%s-undelivered"
+	//RdbClaim is held by the call sending a client message id, sender receiver and client message id
+	RdbClaim = "%s-%s-%s-claim"
+	//claimTTL only has to outlive one send, a later retry finds the stored row instead
+	claimTTL = time.Minute
+	//serverMsgIdPrefix keeps server generated ids apart from ids chosen by clients
+	serverMsgIdPrefix = "srv-"
+)
+
+// ErrInFlight is returned for a retry of a message whose first attempt has not been stored yet
+var ErrInFlight = errors.New("message with the same client message id is still being sent")
+
+type Result struct {
+	Id        int64
+	ServerDtm time.Time
+	State     string
+}
+
+type Service interface {
+	//Send stores chat message and pushes it to receiver when online
+	Send(ctx context.Context, m model.ChatMessage, clientMsgId string) (Result, error)
+	//Fanout sends a copy of chat message to every receiver, used by room
+	Fanout(ctx context.Context, m model.ChatMessage, clientMsgId string, receivers []string) (Result, error)
+	//Publish pushes frame without persistence, user who is offline just misses it
+	Publish(ctx context.Context, userId string, e model.Envelope) (int64, error)
+	//Subscribe receives frames for one device of the user
+	Subscribe(ctx context.Context, userId, deviceId string) (Subscription, error)
+	//Resolve turns transport payload into frame for client, id is non zero when message must be marked delivered after write
+	Resolve(ctx context.Context, userId, payload string) ([]byte, int64, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	//PublishRef pushes reference of stored message, receiver resolves it with Resolve
+	PublishRef(ctx context.Context, userId string, msgId int64, clientMsgId string) (int64, error)
+	//Spill stores frame which could not be written to a slow client as undelivered
+	Spill(ctx context.Context, userId, payload string) error
+}
+
+type service struct {
+	cache       cache.Cache
+	messageRepo repository.Message
+	unread      unread.Counter
+	presence    presence.Tracker
+	transport   Transport
+	writePath   string
+}
+
+func NewService(cache cache.Cache, messageRepo repository.Message, unread unread.Counter, presence presence.Tracker, env config.Env) (Service, error) {
+	transport, err := NewTransport(cache, env)
+	if err != nil {
+		return nil, err
+	}
+	switch env.WritePath {
+	case "":
+		env.WritePath = WritePublishFirst
+	case WritePublishFirst, WritePersistFirst, WriteOutbox:
+	default:
+		return nil, fmt.Errorf("unsupported write path: %q", env.WritePath)
+	}
+	return &service{
+		cache:       cache,
+		messageRepo: messageRepo,
+		unread:      unread,
+		presence:    presence,
+		transport:   transport,
+		writePath:   env.WritePath,
+	}, nil
+}
+
+func (s service) Send(ctx context.Context, m model.ChatMessage, clientMsgId string) (Result, error) {
+	//only the call winning the claim sends, a retry racing it must not publish the message twice
+	claimed := true
+	if clientMsgId != "" {
+		won, err := s.cache.SetNX(ctx, fmt.Sprintf(RdbClaim, m.SenderId, m.ReceiverId, clientMsgId), "1", claimTTL)
+		if err != nil {
+			//without claim the message is only stored, unique index keeps one row and receiver fetches it as undelivered
+			zap.S().Errorf("s.cache.SetNX: %v", err)
+			claimed = false
+		}
+
+		//client retried a message we already accepted, answer with the original id and do not deliver it twice
+		origin, err := s.messageRepo.FindByClientMsgId(ctx, m.SenderId, m.ReceiverId, clientMsgId)
+		if err != nil {
+			return Result{}, err
+		}
+		if origin != nil {
+			result := Result{Id: origin.Id, ServerDtm: time.Now(), State: model.StateStored}
+			if origin.SendDtm != nil {
+				result.ServerDtm = *origin.SendDtm
+			}
+			if origin.IsDelivered {
+				result.State = model.StateDelivered
+			}
+			return result, nil
+		}
+		if claimed && !won {
+			return Result{}, ErrInFlight
+		}
+	}
+
+	//server generated message like a room system message gets an id as well, so a frame dropped for a slow client can be spilled
+	if clientMsgId == "" {
+		clientMsgId = newServerMsgId()
+	}
+	if !claimed {
+		return s.sendStored(ctx, m, clientMsgId, time.Now())
+	}
+	result, err := s.deliver(ctx, m, clientMsgId)
+	if err != nil && clientMsgId != "" {
+		//nothing stored, release the claim so client retry is not rejected as in flight
+		delErr := s.cache.Del(ctx, fmt.Sprintf(RdbClaim, m.SenderId, m.ReceiverId, clientMsgId))
+		if delErr != nil {
+			zap.S().Errorf("s.cache.Del: %v", delErr)
+		}
+	}
+	return result, err
+}
+
+// newServerMsgId fills client message id of a message no client has named, it fits chat_message.client_msg_id
+func newServerMsgId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return serverMsgIdPrefix + hex.EncodeToString(b)
+}
+
+// deliver sends message by the configured write path, caller holds the claim of client message id
+func (s service) deliver(ctx context.Context, m model.ChatMessage, clientMsgId string) (Result, error) {
+	if s.writePath == WritePersistFirst || s.writePath == WriteOutbox {
+		return s.sendPersisted(ctx, m, clientMsgId)
+	}
+
+	//check if target user is now online, if yes publish message into redis pub/sub and then insert the msg into db as delivered
+	//make sure that message delivered to target otherwise system should insert data into database instead
+	n := time.Now()
+	m.SendDtm = &n
+
+	//check if target user online
+	var r, id int64
+	online, err := s.presence.IsOnline(ctx, m.ReceiverId)
+	if err == nil && online {
+		//target user is online then publish message to every device of the user
+		out, _ := model.NewEnvelope(model.KindChat, clientMsgId, &m)
+		j, _ := json.Marshal(&out)
+		r, err = s.transport.Publish(ctx, m.ReceiverId, string(j))
+		if err != nil {
+			zap.S().Errorf("s.transport.Publish: %v", err)
+			goto offline
+		}
+		if r == 0 {
+			zap.S().Infof("not found subscriber of %s then insert chat-message into database", m.ReceiverId)
+			goto offline
+		}
+
+		//receiver got the message then keep it as delivered
+		id, err = s.saveMsg(ctx, m, clientMsgId, n, true)
+		if err != nil && err != repository.ErrDuplicate {
+			return Result{}, err
+		}
+		s.incrUnread(ctx, m, err)
+		return Result{Id: id, ServerDtm: n, State: model.StateDelivered}, nil
+	}
+
+	//err while get cache
+	if err != nil {
+		zap.S().Errorf("error while get user status then insert chat-message into database: %v", err)
+		goto offline
+	}
+
+	//no device connected
+	if !online {
+		zap.S().Infof("%s is not online then insert chat-message into database", m.ReceiverId)
+		goto offline
+	}
+
+offline:
+	return s.sendStored(ctx, m, clientMsgId, n)
+}
+
+// sendStored keeps message as undelivered and raises the flag so receiver fetches it on connect
+func (s service) sendStored(ctx context.Context, m model.ChatMessage, clientMsgId string, n time.Time) (Result, error) {
+	m.SendDtm = &n
+	id, err := s.saveMsg(ctx, m, clientMsgId, n, false)
+	if err != nil && err != repository.ErrDuplicate {
+		return Result{}, err
+	}
+	s.incrUnread(ctx, m, err)
+
+	//set
+	err = s.cache.Set(ctx, fmt.Sprintf(RdbUndelivered, m.ReceiverId), time.Now().Format(time.RFC3339Nano), 24*time.Hour)
+	if err != nil {
+		zap.S().Errorf("s.cache.Set: %v", err)
+	}
+	return Result{Id: id, ServerDtm: n, State: model.StateStored}, nil
+}
+
+func (s service) Fanout(ctx context.Context, m model.ChatMessage, clientMsgId string, receivers []string) (Result, error) {
+	//every receiver owns a row so undelivered and read state are tracked per member
+	var result Result
+	var firstErr error
+	delivered := true
+	for _, receiverId := range receivers {
+		if receiverId == m.SenderId {
+			continue
+		}
+		m.ReceiverId = receiverId
+		r, err := s.Send(ctx, m, clientMsgId)
+		if err != nil {
+			//keep going so one failure does not block other members, retry is deduplicated per receiver
+			zap.S().Errorf("s.Send to %s: %v", receiverId, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if result.Id == 0 {
+			result = r
+		}
+		delivered = delivered && r.State == model.StateDelivered
+	}
+	if firstErr != nil {
+		return Result{}, firstErr
+	}
+
+	result.State = model.StateStored
+	if delivered {
+		result.State = model.StateDelivered
+	}
+	if result.ServerDtm.IsZero() {
+		result.ServerDtm = time.Now()
+	}
+	return result, nil
+}
+
+// Publish pushes envelope to user channel only when the user is online, it returns number of subscribers received
+func (s service) Publish(ctx context.Context, userId string, e model.Envelope) (int64, error) {
+	online, err := s.presence.IsOnline(ctx, userId)
+	if err != nil || !online {
+		return 0, err
+	}
+
+	j, err := json.Marshal(&e)
+	if err != nil {
+		return 0, err
+	}
+	return s.transport.Publish(ctx, userId, string(j))
+}
+
+func (s service) Subscribe(ctx context.Context, userId, deviceId string) (Subscription, error) {
+	return s.transport.Subscribe(ctx, userId, deviceId)
+}
+
+// incrUnread counts newly stored direct message for receiver inbox, duplicate was counted on first attempt
+func (s service) incrUnread(ctx context.Context, m model.ChatMessage, saveErr error) {
+	if saveErr == repository.ErrDuplicate || m.RoomId != 0 {
+		return
+	}
+	err := s.unread.Incr(ctx, m.ReceiverId, m.SenderId)
+	if err != nil {
+		zap.S().Errorf("s.unread.Incr: %v", err)
+	}
+}
+
+func (s service) saveMsg(ctx context.Context, m model.ChatMessage, clientMsgId string, n time.Time, isDelivered bool) (int64, error) {
+	e := repository.MessageEntity{
+		ClientMsgId: clientMsgId,
+		RoomId:      m.RoomId,
+		ReceiverId:  m.ReceiverId,
+		SenderId:    m.SenderId,
+		Message:     m.Msg,
+		IsDelivered: isDelivered,
+		SendDtm:     &n,
+	}
+	if isDelivered {
+		e.DeliveredDtm = &n
+	}
+	create := s.messageRepo.Create
+	if s.writePath == WriteOutbox {
+		create = s.messageRepo.CreateWithOutbox
+	}
+	id, err := create(ctx, e)
+	if err != nil && err != repository.ErrDuplicate {
+		zap.S().Errorf("s.messageRepo.Create: %v", err)
+	}
+	return id, err
+}
@@ -0,0 +1,245 @@
+package delivery
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/model"
+	"chat-session/internal/presence"
+	"chat-session/internal/repository"
+	"chat-session/internal/tests/mock"
+	"chat-session/internal/tests/mock_repository"
+	"chat-session/internal/unread"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_saveMsg(t *testing.T) {
+	n := time.Now()
+	tt := []struct {
+		name            string
+		m               model.ChatMessage
+		chatMessageRepo repository.Message
+		isDelivered     bool
+		expectedE       error
+	}{
+		{
+			name:            "should return nil when create chat message successfully",
+			m:               model.ChatMessage{},
+			chatMessageRepo: mock.ChatMessageRepo(t, "OK", n),
+			isDelivered:     false,
+			expectedE:       nil,
+		},
+		{
+			name:            "should return error when err while create chat message",
+			m:               model.ChatMessage{},
+			chatMessageRepo: mock.ChatMessageRepo(t, "!OK", n),
+			isDelivered:     false,
+			expectedE:       errors.New("mock err"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := service{messageRepo: tc.chatMessageRepo}
+			_, e := s.saveMsg(context.Background(), tc.m, "", n, tc.isDelivered)
+			assert.Equal(t, tc.expectedE, e)
+		})
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	repo := mock_repository.NewMockMessage(gomock.NewController(t))
+	repo.EXPECT().FindByIds(gomock.Any(), "uefa", []int64{7}).Return([]repository.MessageEntity{{Id: 7, ReceiverId: "uefa", SenderId: "fifa", Message: "hi"}}, nil).AnyTimes()
+	repo.EXPECT().FindByIds(gomock.Any(), "uefa", []int64{8}).Return(nil, nil).AnyTimes()
+
+	tt := []struct {
+		name          string
+		payload       string
+		expectedFrame string
+		expectedId    int64
+		expectedErr   bool
+	}{
+		{
+			name:          "should relay payload as is when it is not a reference",
+			payload:       `{"v":1,"type":"chat","id":"c-1","payload":{"msg":"hi"}}`,
+			expectedFrame: `{"v":1,"type":"chat","id":"c-1","payload":{"msg":"hi"}}`,
+		},
+		{
+			name:          "should load message when payload is a reference",
+			payload:       `{"v":1,"type":"chat_ref","id":"c-2","payload":{"msgId":7}}`,
+			expectedFrame: `{"v":1,"type":"chat","id":"c-2","payload":{"id":7,"senderId":"fifa","receiverId":"uefa","msg":"hi","send_dtm":null}}`,
+			expectedId:    7,
+		},
+		{
+			name:        "should return error when referenced message is not found",
+			payload:     `{"v":1,"type":"chat_ref","id":"c-3","payload":{"msgId":8}}`,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := service{messageRepo: repo}
+			frame, id, err := s.Resolve(context.Background(), "uefa", tc.payload)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedId, id)
+			if !tc.expectedErr {
+				assert.JSONEq(t, tc.expectedFrame, string(frame))
+			}
+		})
+	}
+}
+
+func Test_SendClaim(t *testing.T) {
+	n := time.Now()
+	tt := []struct {
+		name          string
+		claimed       bool
+		origin        *repository.MessageEntity
+		createErr     error
+		expected      Result
+		expectedErr   error
+		expectedPub   bool
+		expectedClaim bool
+	}{
+		{
+			name:          "should publish and keep claim when this call wins it",
+			expected:      Result{Id: 7, State: model.StateDelivered},
+			expectedPub:   true,
+			expectedClaim: true,
+		},
+		{
+			name:          "should answer with original message when claim is held and message is stored",
+			claimed:       true,
+			origin:        &repository.MessageEntity{Id: 5, SendDtm: &n, IsDelivered: true},
+			expected:      Result{Id: 5, ServerDtm: n, State: model.StateDelivered},
+			expectedClaim: true,
+		},
+		{
+			name:          "should not publish when claim is held by a send still in flight",
+			claimed:       true,
+			expectedErr:   ErrInFlight,
+			expectedClaim: true,
+		},
+		{
+			name:        "should release claim when message cannot be stored",
+			createErr:   errors.New("mock err"),
+			expectedErr: errors.New("mock err"),
+			expectedPub: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := cache.NewMemory(config.Env{})
+			repo := mock_repository.NewMockMessage(gomock.NewController(t))
+			repo.EXPECT().FindByClientMsgId(gomock.Any(), "fifa", "uefa", "c-1").Return(tc.origin, nil)
+			repo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(int64(7), tc.createErr).AnyTimes()
+			tracker := presence.NewTracker(c, config.Env{HeartbeatTimeout: 60000})
+			_, _ = tracker.Connect(ctx, "uefa", "s-1")
+			sub, _ := c.Sub(ctx, "uefa-channel")
+			claim := "fifa-uefa-c-1-claim"
+			if tc.claimed {
+				_, _ = c.SetNX(ctx, claim, "1", time.Minute)
+			}
+
+			s := service{cache: c, messageRepo: repo, unread: unread.NewCounter(c, repo), presence: tracker, transport: &pubSubTransport{cache: c}, writePath: WritePublishFirst}
+			result, err := s.Send(ctx, model.ChatMessage{SenderId: "fifa", ReceiverId: "uefa", Msg: "hi"}, "c-1")
+			assert.Equal(t, tc.expectedErr, err)
+			if tc.origin == nil {
+				result.ServerDtm = time.Time{}
+			}
+			assert.Equal(t, tc.expected, result)
+
+			msg, _ := sub.Receive(ctx, time.Millisecond)
+			assert.Equal(t, tc.expectedPub, msg != nil)
+			_, err = c.Get(ctx, claim)
+			assert.Equal(t, tc.expectedClaim, err == nil)
+		})
+	}
+}
+
+func Test_Spill(t *testing.T) {
+	tt := []struct {
+		name        string
+		payload     string
+		expectedErr bool
+		expectedSet bool
+	}{
+		{
+			name:    "should drop typing frame without error",
+			payload: `{"v":1,"type":"typing","payload":{"userId":"fifa"}}`,
+		},
+		{
+			name:    "should drop presence frame without error",
+			payload: `{"v":1,"type":"presence","payload":{"userId":"fifa","status":"online"}}`,
+		},
+		{
+			name:    "should drop read frame without error",
+			payload: `{"v":1,"type":"read","payload":{"ids":[1]}}`,
+		},
+		{
+			name:        "should keep stored chat frame undelivered",
+			payload:     `{"v":1,"type":"chat","id":"srv-1","payload":{"senderId":"fifa","receiverId":"uefa","msg":"hi"}}`,
+			expectedSet: true,
+		},
+		{
+			name:        "should return error when chat frame has no id",
+			payload:     `{"v":1,"type":"chat","payload":{"senderId":"fifa","receiverId":"uefa","msg":"hi"}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "should return error for unknown frame",
+			payload:     `{"v":1,"type":"other"}`,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := cache.NewMemory(config.Env{})
+			repo := mock_repository.NewMockMessage(gomock.NewController(t))
+			if tc.expectedSet {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(int64(7), repository.ErrDuplicate)
+				repo.EXPECT().MarkUndelivered(gomock.Any(), []int64{7}).Return(nil)
+			}
+
+			s := service{cache: c, messageRepo: repo}
+			err := s.Spill(ctx, "uefa", tc.payload)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			_, err = c.Get(ctx, "uefa-undelivered")
+			assert.Equal(t, tc.expectedSet, err == nil)
+		})
+	}
+}
+
+func Test_SendServerMsgId(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemory(config.Env{})
+	repo := mock_repository.NewMockMessage(gomock.NewController(t))
+	var stored string
+	repo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, e repository.MessageEntity) (int64, error) {
+		stored = e.ClientMsgId
+		return 7, nil
+	})
+	tracker := presence.NewTracker(c, config.Env{HeartbeatTimeout: 60000})
+	_, _ = tracker.Connect(ctx, "uefa", "s-1")
+	sub, _ := c.Sub(ctx, "uefa-channel")
+
+	//room system message has no client id, the published frame must still name its row so it can be spilled
+	s := service{cache: c, messageRepo: repo, unread: unread.NewCounter(c, repo), presence: tracker, transport: &pubSubTransport{cache: c}, writePath: WritePublishFirst}
+	_, err := s.Send(ctx, model.ChatMessage{RoomId: 1, SenderId: model.SystemSender, ReceiverId: "uefa", Msg: "fifa created the room"}, "")
+	assert.Nil(t, err)
+
+	msg, _ := sub.Receive(ctx, time.Millisecond)
+	if assert.NotNil(t, msg) {
+		var e model.Envelope
+		assert.Nil(t, json.Unmarshal([]byte(msg.Payload), &e))
+		assert.True(t, strings.HasPrefix(e.Id, serverMsgIdPrefix))
+		assert.Equal(t, stored, e.Id)
+	}
+}
@@ -0,0 +1,152 @@
+package delivery
+
+import (
+	"chat-session/internal/model"
+	"chat-session/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	WritePublishFirst = "publish_first"
+	WritePersistFirst = "persist_first"
+	WriteOutbox       = "outbox"
+)
+
+// kindRef is only used between pods, receiver side resolves it to a chat frame before writing to client
+const kindRef = "chat_ref"
+
+type reference struct {
+	MsgId int64 `json:"msgId"`
+}
+
+// sendPersisted stores message before publishing so accepted message is never lost, receiver only marks it delivered.
+// With outbox write path the publish is left to the relay which reads rows written in the same transaction.
+func (s service) sendPersisted(ctx context.Context, m model.ChatMessage, clientMsgId string) (Result, error) {
+	n := time.Now()
+	m.SendDtm = &n
+
+	id, err := s.saveMsg(ctx, m, clientMsgId, n, false)
+	if err != nil && err != repository.ErrDuplicate {
+		return Result{}, err
+	}
+	s.incrUnread(ctx, m, err)
+
+	//flag stays until some device of receiver fetches undelivered message, covers a receiver pod dying before write
+	err = s.cache.Set(ctx, fmt.Sprintf(RdbUndelivered, m.ReceiverId), n.Format(time.RFC3339Nano), 24*time.Hour)
+	if err != nil {
+		zap.S().Errorf("s.cache.Set: %v", err)
+	}
+
+	result := Result{Id: id, ServerDtm: n, State: model.StateStored}
+	if s.writePath == WriteOutbox {
+		return result, nil
+	}
+
+	r, err := s.PublishRef(ctx, m.ReceiverId, id, clientMsgId)
+	if err != nil {
+		zap.S().Errorf("s.PublishRef: %v", err)
+		return result, nil
+	}
+	if r > 0 {
+		result.State = model.StateDelivered
+	}
+	return result, nil
+}
+
+// PublishRef pushes reference of stored message to receiver when online
+func (s service) PublishRef(ctx context.Context, userId string, msgId int64, clientMsgId string) (int64, error) {
+	out, err := model.NewEnvelope(kindRef, clientMsgId, &reference{MsgId: msgId})
+	if err != nil {
+		return 0, err
+	}
+	return s.Publish(ctx, userId, out)
+}
+
+func (s service) Resolve(ctx context.Context, userId, payload string) ([]byte, int64, error) {
+	var e model.Envelope
+	if json.Unmarshal([]byte(payload), &e) != nil || e.Type != kindRef {
+		//publish first path already carries the whole frame
+		return []byte(payload), 0, nil
+	}
+
+	var ref reference
+	err := json.Unmarshal(e.Payload, &ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	entities, err := s.messageRepo.FindByIds(ctx, userId, []int64{ref.MsgId})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entities) == 0 {
+		return nil, 0, fmt.Errorf("message %d of %s not found", ref.MsgId, userId)
+	}
+
+	entity := entities[0]
+	out, err := model.NewEnvelope(model.KindChat, e.Id, &model.ChatMessage{
+		Id:         entity.Id,
+		RoomId:     entity.RoomId,
+		ReceiverId: entity.ReceiverId,
+		SenderId:   entity.SenderId,
+		Msg:        entity.Message,
+		SendDtm:    entity.SendDtm,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	j, err := json.Marshal(&out)
+	return j, entity.Id, err
+}
+
+func (s service) MarkDelivered(ctx context.Context, id int64) error {
+	return s.messageRepo.MarkDelivered(ctx, []int64{id}, time.Now())
+}
+
+// Spill keeps frame the receiver connection could not take as undelivered message, so it is fetched again on reconnect
+func (s service) Spill(ctx context.Context, userId, payload string) error {
+	var e model.Envelope
+	err := json.Unmarshal([]byte(payload), &e)
+	if err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case model.KindTyping, model.KindPresence, model.KindRead:
+		//ephemeral frame, read state is kept in database and typing or presence is sent again on next change
+		return nil
+	case kindRef:
+		//persisted message stays undelivered until written, only the flag is needed
+	case model.KindChat:
+		//every chat frame carries a client or server message id, without it the row saved by sender cannot be found
+		if e.Id == "" {
+			return fmt.Errorf("cannot spill chat frame without client message id")
+		}
+		var m model.ChatMessage
+		err = json.Unmarshal(e.Payload, &m)
+		if err != nil {
+			return err
+		}
+		n := time.Now()
+		if m.SendDtm != nil {
+			n = *m.SendDtm
+		}
+
+		//sender may not have saved it yet, then sender save hits the unique index and keeps this undelivered row
+		id, err := s.saveMsg(ctx, m, e.Id, n, false)
+		if err == repository.ErrDuplicate {
+			err = s.messageRepo.MarkUndelivered(ctx, []int64{id})
+		} else if err == nil {
+			s.incrUnread(ctx, m, nil)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot spill %s frame", e.Type)
+	}
+	return s.cache.Set(ctx, fmt.Sprintf(RdbUndelivered, userId), time.Now().Format(time.RFC3339Nano), 24*time.Hour)
+}
@@ -0,0 +1,210 @@
+package delivery
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	BackendPubSub = "pubsub"
+	BackendStream = "stream"
+)
+
+const (
+	RdbStream = "%s-stream"
+	//RdbStreamLease marks consumer group of user device as held by a live connection
+	RdbStreamLease = "%s-stream-%s-lease"
+	groupDefault   = "default"
+	leaseValue     = "1"
+	streamLeaseTTL = 30 * time.Second
+)
+
+// Msg is one frame received from transport, Id is only set by stream backend
+type Msg struct {
+	Id      string
+	Payload string
+}
+
+type Subscription interface {
+	//Receive waits up to timeout, nil message without error means nothing arrived
+	Receive(timeout time.Duration) (*Msg, error)
+	//Ack confirms the message was written to client, unacked stream message is replayed on reconnect
+	Ack(m *Msg) error
+	Close() error
+}
+
+// Transport moves frames to connections of a user, pub/sub is fire-and-forget while stream keeps entries until acked
+type Transport interface {
+	Publish(ctx context.Context, userId, payload string) (int64, error)
+	//Subscribe binds subscription to ctx, it ends when ctx is done
+	Subscribe(ctx context.Context, userId, deviceId string) (Subscription, error)
+}
+
+func NewTransport(cache cache.Cache, env config.Env) (Transport, error) {
+	switch env.DeliveryBackend {
+	case "", BackendPubSub:
+		return &pubSubTransport{cache: cache}, nil
+	case BackendStream:
+		return &streamTransport{cache: cache, maxLen: env.StreamMaxLen}, nil
+	}
+	return nil, fmt.Errorf("unsupported delivery backend: %q", env.DeliveryBackend)
+}
+
+type pubSubTransport struct {
+	cache cache.Cache
+}
+
+func (t pubSubTransport) Publish(ctx context.Context, userId, payload string) (int64, error) {
+	return t.cache.Pub(ctx, fmt.Sprintf(RdbPublish, userId), payload)
+}
+
+func (t pubSubTransport) Subscribe(ctx context.Context, userId, _ string) (Subscription, error) {
+	sub, err := t.cache.Sub(ctx, fmt.Sprintf(RdbPublish, userId))
+	if err != nil {
+		return nil, err
+	}
+	return &pubSubSubscription{ctx: ctx, sub: sub}, nil
+}
+
+type pubSubSubscription struct {
+	ctx context.Context
+	sub cache.Subscription
+}
+
+func (s pubSubSubscription) Receive(timeout time.Duration) (*Msg, error) {
+	m, err := s.sub.Receive(s.ctx, timeout)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return &Msg{Payload: m.Payload}, nil
+}
+
+func (s pubSubSubscription) Ack(*Msg) error {
+	return nil
+}
+
+func (s pubSubSubscription) Close() error {
+	return s.sub.Close()
+}
+
+type streamTransport struct {
+	cache  cache.Cache
+	maxLen int64
+}
+
+// Publish returns number of consumer groups of the stream, every device group keeps the entry until it reads and acks it
+func (t streamTransport) Publish(ctx context.Context, userId, payload string) (int64, error) {
+	stream := fmt.Sprintf(RdbStream, userId)
+	_, err := t.cache.XAdd(ctx, stream, payload, t.maxLen)
+	if err != nil {
+		return 0, err
+	}
+	return t.cache.XGroupCount(ctx, stream)
+}
+
+// Subscribe joins the consumer group of the device, every device has its own group so each one gets every entry.
+// Connection without device id uses the default group of the user. Only one connection holds a group at a time, another
+// connection of the same device gets an ephemeral group which starts at new entries and is destroyed on close.
+func (t streamTransport) Subscribe(ctx context.Context, userId, deviceId string) (Subscription, error) {
+	stream := fmt.Sprintf(RdbStream, userId)
+	group := deviceId
+	if group == "" {
+		group = groupDefault
+	}
+	lease := fmt.Sprintf(RdbStreamLease, userId, group)
+	owner, err := t.cache.SetNX(ctx, lease, leaseValue, streamLeaseTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !owner {
+		group = group + "-" + ephemeralId()
+	}
+
+	//new group starts at entries added from now on, existing group continues where the device stopped
+	err = t.cache.XGroupCreate(ctx, stream, group, "$")
+	if err != nil {
+		return nil, err
+	}
+	sub := &streamSubscription{ctx: ctx, cache: t.cache, stream: stream, group: group, pending: owner, leased: time.Now()}
+	if owner {
+		sub.lease = lease
+	}
+	return sub, nil
+}
+
+type streamSubscription struct {
+	ctx    context.Context
+	cache  cache.Cache
+	stream string
+	group  string
+	//lease is empty for ephemeral group
+	lease   string
+	leased  time.Time
+	pending bool
+	//lastId is where replay continues, ack of a replayed entry lands asynchronously after the next read
+	lastId string
+}
+
+func (s *streamSubscription) Receive(timeout time.Duration) (*Msg, error) {
+	s.renew()
+
+	//replay entries delivered to the previous connection of this device but never acked, then read new entries
+	id := ">"
+	if s.pending {
+		id = "0"
+		if s.lastId != "" {
+			id = s.lastId
+		}
+	}
+	messages, err := s.cache.XReadGroup(s.ctx, s.stream, s.group, s.group, id, 1, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		s.pending = false
+		return nil, nil
+	}
+	if s.pending {
+		s.lastId = messages[0].Id
+	}
+
+	return &Msg{Id: messages[0].Id, Payload: messages[0].Payload}, nil
+}
+
+// renew extends group lease while the connection is alive, a crashed pod leaves the group after streamLeaseTTL
+func (s *streamSubscription) renew() {
+	if s.lease == "" || time.Since(s.leased) < streamLeaseTTL/3 {
+		return
+	}
+	s.leased = time.Now()
+	err := s.cache.Set(s.ctx, s.lease, leaseValue, streamLeaseTTL)
+	if err != nil {
+		zap.S().Errorf("s.cache.Set: %v", err)
+	}
+}
+
+func (s *streamSubscription) Ack(m *Msg) error {
+	return s.cache.XAck(s.ctx, s.stream, s.group, m.Id)
+}
+
+// Close releases group lease so the next connection of the device replays, ephemeral group is destroyed with its entries
+func (s *streamSubscription) Close() error {
+	//connection ctx is usually done already
+	ctx := context.Background()
+	if s.lease != "" {
+		return s.cache.Del(ctx, s.lease)
+	}
+	return s.cache.XGroupDestroy(ctx, s.stream, s.group)
+}
+
+func ephemeralId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
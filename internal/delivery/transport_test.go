@@ -0,0 +1,142 @@
+package delivery
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/tests/mock_cache"
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_streamPublish(t *testing.T) {
+	tt := []struct {
+		name        string
+		groups      int64
+		addErr      error
+		expected    int64
+		expectedErr error
+	}{
+		{
+			name:     "should return number of groups when entry is added",
+			groups:   2,
+			expected: 2,
+		},
+		{
+			name:     "should return zero when no device group reads the stream",
+			groups:   0,
+			expected: 0,
+		},
+		{
+			name:        "should return error when add fails",
+			addErr:      errors.New("mock err"),
+			expectedErr: errors.New("mock err"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := mock_cache.NewMockCache(gomock.NewController(t))
+			c.EXPECT().XAdd(gomock.Any(), "uefa-stream", "hi", int64(10)).Return("1-0", tc.addErr)
+			if tc.addErr == nil {
+				c.EXPECT().XGroupCount(gomock.Any(), "uefa-stream").Return(tc.groups, nil)
+			}
+			tr := streamTransport{cache: c, maxLen: 10}
+			n, err := tr.Publish(context.Background(), "uefa", "hi")
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, n)
+		})
+	}
+}
+
+func Test_streamSubscribe(t *testing.T) {
+	tt := []struct {
+		name            string
+		deviceId        string
+		owner           bool
+		expectedLease   string
+		expectedGroup   string
+		expectedPending bool
+	}{
+		{
+			name:            "should join device group and replay pending when device is free",
+			deviceId:        "phone",
+			owner:           true,
+			expectedLease:   "uefa-stream-phone-lease",
+			expectedGroup:   "phone",
+			expectedPending: true,
+		},
+		{
+			name:            "should fall back to default group of user when device id is missing",
+			owner:           true,
+			expectedLease:   "uefa-stream-default-lease",
+			expectedGroup:   "default",
+			expectedPending: true,
+		},
+		{
+			name:          "should join ephemeral group when device group is held by another connection",
+			deviceId:      "phone",
+			expectedLease: "uefa-stream-phone-lease",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := mock_cache.NewMockCache(gomock.NewController(t))
+			c.EXPECT().SetNX(gomock.Any(), tc.expectedLease, leaseValue, streamLeaseTTL).Return(tc.owner, nil)
+			var group string
+			c.EXPECT().XGroupCreate(gomock.Any(), "uefa-stream", gomock.Any(), "$").DoAndReturn(func(_ context.Context, _, g, _ string) error {
+				group = g
+				return nil
+			})
+			if tc.owner {
+				c.EXPECT().Del(gomock.Any(), tc.expectedLease).Return(nil)
+			} else {
+				c.EXPECT().XGroupDestroy(gomock.Any(), "uefa-stream", gomock.Any()).DoAndReturn(func(_ context.Context, _, g string) error {
+					assert.Equal(t, group, g)
+					return nil
+				})
+			}
+
+			tr := streamTransport{cache: c}
+			sub, err := tr.Subscribe(context.Background(), "uefa", tc.deviceId)
+			assert.Nil(t, err)
+			s := sub.(*streamSubscription)
+			if tc.owner {
+				assert.Equal(t, tc.expectedGroup, group)
+			} else {
+				assert.Contains(t, group, tc.deviceId+"-")
+			}
+			assert.Equal(t, group, s.group)
+			assert.Equal(t, tc.expectedPending, s.pending)
+			assert.Nil(t, sub.Close())
+		})
+	}
+}
+
+func Test_streamReceive(t *testing.T) {
+	c := mock_cache.NewMockCache(gomock.NewController(t))
+	gomock.InOrder(
+		c.EXPECT().XReadGroup(gomock.Any(), "uefa-stream", "phone", "phone", "0", int64(1), time.Second).Return([]cache.StreamEntry{{Id: "1-0", Payload: "old"}}, nil),
+		//next replay read starts after the entry returned, its ack may not have landed yet
+		c.EXPECT().XReadGroup(gomock.Any(), "uefa-stream", "phone", "phone", "1-0", int64(1), time.Second).Return(nil, nil),
+		c.EXPECT().XReadGroup(gomock.Any(), "uefa-stream", "phone", "phone", ">", int64(1), time.Second).Return([]cache.StreamEntry{{Id: "2-0", Payload: "new"}}, nil),
+	)
+	//lease is renewed once a third of its ttl has passed
+	c.EXPECT().Set(gomock.Any(), "uefa-stream-phone-lease", leaseValue, streamLeaseTTL).Return(nil).Times(1)
+
+	s := &streamSubscription{ctx: context.Background(), cache: c, stream: "uefa-stream", group: "phone", lease: "uefa-stream-phone-lease", leased: time.Now().Add(-streamLeaseTTL), pending: true}
+	m, err := s.Receive(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, &Msg{Id: "1-0", Payload: "old"}, m)
+
+	//replay is done once nothing is pending
+	m, err = s.Receive(time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+	assert.False(t, s.pending)
+
+	m, err = s.Receive(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, &Msg{Id: "2-0", Payload: "new"}, m)
+}
@@ -0,0 +1,139 @@
+package migration
+
+import (
+	"chat-session/internal/repository"
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// hook runs after the script of its version and before the version is recorded, inside the same transaction when the driver has one
+type hook func(ctx context.Context, db execQueryer, driver string) error
+
+var hooks = map[int64]hook{
+	1: upgradeLegacyMessage,
+}
+
+// legacyColumns are missing from chat_message of the first release, upgrade is supported from that release only
+var legacyColumns = []struct {
+	name string
+	ddl  map[string]string
+}{
+	{
+		name: "client_msg_id",
+		ddl:  map[string]string{repository.DriverMySQL: "VARCHAR(64)", repository.DriverPostgres: "VARCHAR(64)", repository.DriverSQLite: "VARCHAR(64)"},
+	},
+	{
+		name: "room_id",
+		ddl:  map[string]string{repository.DriverMySQL: "BIGINT", repository.DriverPostgres: "BIGINT", repository.DriverSQLite: "BIGINT"},
+	},
+	{
+		name: "is_delivered",
+		ddl:  map[string]string{repository.DriverMySQL: "CHAR(1)", repository.DriverPostgres: "BOOLEAN NOT NULL DEFAULT FALSE", repository.DriverSQLite: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	},
+	{
+		name: "delivered_dtm",
+		ddl:  map[string]string{repository.DriverMySQL: "datetime", repository.DriverPostgres: "TIMESTAMP", repository.DriverSQLite: "DATETIME"},
+	},
+}
+
+var uniqueColumns = []string{"sender_id", "receiver_id", "client_msg_id"}
+
+// upgradeLegacyMessage brings chat_message of an earlier release to the baseline shape, a table created by the baseline is left as is
+func upgradeLegacyMessage(ctx context.Context, db execQueryer, driver string) error {
+	existing, err := queryStrings(ctx, db, map[string]string{
+		repository.DriverMySQL:    "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'chat_message'",
+		repository.DriverPostgres: "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'chat_message'",
+		repository.DriverSQLite:   "SELECT name FROM pragma_table_info('chat_message')",
+	}[driver])
+	if err != nil {
+		return err
+	}
+	has := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		has[strings.ToLower(c)] = true
+	}
+
+	for _, c := range legacyColumns {
+		if has[c.name] {
+			continue
+		}
+		_, err = db.ExecContext(ctx, "ALTER TABLE chat_message ADD COLUMN "+c.name+" "+c.ddl[driver])
+		if err != nil {
+			return err
+		}
+	}
+	//earlier release marked message read once it was pushed, so read message counts as delivered
+	//mysql cannot roll back a half done hook, its new column is null until backfilled so a retry picks up the rest
+	backfill := ""
+	switch {
+	case driver == repository.DriverMySQL:
+		backfill = "UPDATE chat_message SET is_delivered = is_read WHERE is_delivered IS NULL AND is_read IS NOT NULL"
+	case !has["is_delivered"]:
+		backfill = "UPDATE chat_message SET is_delivered = is_read WHERE is_read IS NOT NULL"
+	}
+	if backfill != "" {
+		_, err = db.ExecContext(ctx, backfill)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = db.ExecContext(ctx, "UPDATE chat_message SET delivered_dtm = read_dtm WHERE delivered_dtm IS NULL AND read_dtm IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	return upgradeUniqueKey(ctx, db, driver, !has["client_msg_id"])
+}
+
+// upgradeUniqueKey adds uq_sender_client_msg to a table of the first release, commits between the first release and
+// the baseline migration changed chat_message without an upgrade step and are only deployable together with it
+func upgradeUniqueKey(ctx context.Context, db execQueryer, driver string, added bool) error {
+	if driver == repository.DriverSQLite {
+		//sqlite cannot add a constraint, baseline table has it inline so only an upgraded table needs the index
+		if !added {
+			return nil
+		}
+		_, err := db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS uq_sender_client_msg ON chat_message ("+strings.Join(uniqueColumns, ", ")+")")
+		return err
+	}
+
+	//mysql keeps the added column when a later statement fails, so a retry looks for the key instead of trusting added
+	columns, err := queryStrings(ctx, db, map[string]string{
+		repository.DriverMySQL:    "SELECT column_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'chat_message' AND index_name = 'uq_sender_client_msg'",
+		repository.DriverPostgres: "SELECT column_name FROM information_schema.key_column_usage WHERE table_schema = current_schema() AND table_name = 'chat_message' AND constraint_name = 'uq_sender_client_msg'",
+	}[driver])
+	if err != nil || len(columns) > 0 {
+		return err
+	}
+
+	add := "ADD CONSTRAINT uq_sender_client_msg UNIQUE (" + strings.Join(uniqueColumns, ", ") + ")"
+	if driver == repository.DriverMySQL {
+		add = "ADD UNIQUE KEY uq_sender_client_msg (" + strings.Join(uniqueColumns, ", ") + ")"
+	}
+	_, err = db.ExecContext(ctx, "ALTER TABLE chat_message "+add)
+	return err
+}
+
+func queryStrings(ctx context.Context, db execQueryer, query string) ([]string, error) {
+	r, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var values []string
+	for r.Next() {
+		var v string
+		err = r.Scan(&v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, r.Err()
+}
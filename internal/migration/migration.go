@@ -0,0 +1,312 @@
+package migration
+
+import (
+	"chat-session/internal/repository"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tableName = "schema_migrations"
+	//lockName identifies the migration lock, every replica uses the same one
+	lockName = "chat_session_migrate"
+	//lockKey is the postgres advisory lock key, the bytes of "chat_mig"
+	lockKey     = int64(0x636861745f6d6967)
+	lockTimeout = 60
+)
+
+//go:embed sql
+var files embed.FS
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Version    int64
+	Name       string
+	AppliedDtm *time.Time
+}
+
+type Migrator interface {
+	//Up applies every pending migration in order and returns the applied ones
+	Up(ctx context.Context) ([]Migration, error)
+	//Down reverts the last steps applied migrations and returns the reverted ones
+	Down(ctx context.Context, steps int) ([]Migration, error)
+	Status(ctx context.Context) ([]Status, error)
+}
+
+type migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+func New(db *sql.DB, driver string) (Migrator, error) {
+	if driver == "" {
+		driver = repository.DriverMySQL
+	}
+	migrations, err := load(files, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// load reads <version>_<name>.up.sql and .down.sql pairs of driver directory, every up needs its down
+func load(fsys fs.FS, driver string) ([]Migration, error) {
+	dir := path.Join("sql", driver)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported database driver: %q", driver)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		i := strings.Index(base, "_")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.ParseInt(base[:i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", name)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[i+1:]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (mg migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := mg.locked(ctx, func(conn *sql.Conn) error {
+		done, err := mg.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range mg.migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err = mg.run(ctx, conn, m.up, hooks[m.Version], repository.Rebind(mg.driver, "INSERT INTO "+tableName+" (version, name, applied_dtm) VALUES (?, ?, ?)"), m.Version, m.Name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (mg migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := mg.locked(ctx, func(conn *sql.Conn) error {
+		done, err := mg.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(mg.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := mg.migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			err = mg.run(ctx, conn, m.down, nil, repository.Rebind(mg.driver, "DELETE FROM "+tableName+" WHERE version = ?"), m.Version)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (mg migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = mg.createTable(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	done, err := mg.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(mg.migrations))
+	for _, m := range mg.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if dtm, ok := done[m.Version]; ok {
+			s.AppliedDtm = &dtm
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// locked runs fn while holding the migration lock on a dedicated connection, so replicas starting together migrate once
+func (mg migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch mg.driver {
+	case repository.DriverMySQL:
+		var ok sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&ok)
+		if err != nil {
+			return err
+		}
+		if ok.Int64 != 1 {
+			return fmt.Errorf("migration lock %s is held by another instance", lockName)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	case repository.DriverPostgres:
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}
+	//sqlite is a single local file, each migration runs in a write transaction which already serializes writers
+
+	err = mg.createTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (mg migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	dtm := "DATETIME"
+	if mg.driver == repository.DriverPostgres {
+		dtm = "TIMESTAMP"
+	}
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_dtm %s NOT NULL)", tableName, dtm))
+	return err
+}
+
+func (mg migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	r, err := conn.QueryContext(ctx, "SELECT version, applied_dtm FROM "+tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	done := make(map[int64]time.Time)
+	for r.Next() {
+		var version int64
+		var dtm time.Time
+		err = r.Scan(&version, &dtm)
+		if err != nil {
+			return nil, err
+		}
+		done[version] = dtm
+	}
+	return done, r.Err()
+}
+
+// run executes migration script and its hook and records it in one transaction, mysql still commits ddl implicitly
+// so a migration that changes data keeps it in its own dml-only script and is never applied twice
+func (mg migrator) run(ctx context.Context, conn *sql.Conn, script string, h hook, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = mg.exec(ctx, tx, script, h)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (mg migrator) exec(ctx context.Context, db execQueryer, script string, h hook) error {
+	for _, stmt := range statements(script) {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	if h == nil {
+		return nil
+	}
+	return h(ctx, db, mg.driver)
+}
+
+// statements splits script on ; at line end and drops -- comment lines, scripts must not put ; inside literals
+func statements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";\n") {
+		stmt = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
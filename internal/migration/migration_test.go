@@ -0,0 +1,245 @@
+package migration
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/repository"
+	"context"
+	"database/sql"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_statements(t *testing.T) {
+	tt := []struct {
+		name     string
+		script   string
+		expected []string
+	}{
+		{
+			name:     "should split statements on semicolon at line end",
+			script:   "CREATE TABLE a (id INT);\nCREATE INDEX i ON a (id);\n",
+			expected: []string{"CREATE TABLE a (id INT)", "CREATE INDEX i ON a (id)"},
+		},
+		{
+			name:     "should drop comment lines",
+			script:   "-- comment; with semicolon\nDROP TABLE a;",
+			expected: []string{"DROP TABLE a"},
+		},
+		{
+			name:   "should return nothing when script is empty",
+			script: "\n-- only comment\n",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, statements(tc.script))
+		})
+	}
+}
+
+func Test_load(t *testing.T) {
+	tt := []struct {
+		name             string
+		fsys             fstest.MapFS
+		expectedVersions []int64
+		expectedErr      bool
+	}{
+		{
+			name: "should sort migrations by version",
+			fsys: fstest.MapFS{
+				"sql/sqlite/0002_b.up.sql":   {Data: []byte("b")},
+				"sql/sqlite/0002_b.down.sql": {Data: []byte("b")},
+				"sql/sqlite/0001_a.up.sql":   {Data: []byte("a")},
+				"sql/sqlite/0001_a.down.sql": {Data: []byte("a")},
+			},
+			expectedVersions: []int64{1, 2},
+		},
+		{
+			name: "should return error when down file is missing",
+			fsys: fstest.MapFS{
+				"sql/sqlite/0001_a.up.sql": {Data: []byte("a")},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "should return error when driver has no migrations",
+			fsys:        fstest.MapFS{},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := load(tc.fsys, repository.DriverSQLite)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tc.expectedVersions, versions)
+		})
+	}
+}
+
+func Test_migrator(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(repository.DriverSQLite, "file:"+filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, repository.DriverSQLite)
+	assert.Nil(t, err)
+
+	applied, err := m.Up(ctx)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, applied)
+	_, err = db.Exec("SELECT id FROM chat_message")
+	assert.Nil(t, err)
+
+	//up again applies nothing
+	applied, err = m.Up(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := m.Status(ctx)
+	assert.Nil(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedDtm)
+	}
+
+	reverted, err := m.Down(ctx, len(statuses))
+	assert.Nil(t, err)
+	assert.Len(t, reverted, len(statuses))
+	_, err = db.Exec("SELECT id FROM chat_message")
+	assert.NotNil(t, err)
+
+	statuses, err = m.Status(ctx)
+	assert.Nil(t, err)
+	for _, s := range statuses {
+		assert.Nil(t, s.AppliedDtm)
+	}
+}
+
+// Test_mysqlDataMigration guards mysql migrations, ddl commits implicitly so an update next to ddl is kept after
+// a failed ddl and runs again on retry, it must only fill null values which a second run leaves alone
+func Test_mysqlDataMigration(t *testing.T) {
+	migrations, err := load(files, repository.DriverMySQL)
+	assert.Nil(t, err)
+	for _, m := range migrations {
+		for _, script := range []string{m.up, m.down} {
+			var updates []string
+			ddl := false
+			for _, stmt := range statements(script) {
+				switch strings.ToUpper(strings.Fields(stmt)[0]) {
+				case "UPDATE", "INSERT", "DELETE":
+					updates = append(updates, stmt)
+				default:
+					ddl = true
+				}
+			}
+			if !ddl {
+				continue
+			}
+			for _, stmt := range updates {
+				assert.Contains(t, strings.ToUpper(stmt), "IS NULL", "migration %04d_%s changes data next to ddl: %s", m.Version, m.Name, stmt)
+			}
+		}
+	}
+}
+
+func Test_upgradeLegacy(t *testing.T) {
+	tt := []struct {
+		name   string
+		driver string
+		urlEnv string
+		ddl    string
+	}{
+		{
+			name:   "mysql first release",
+			driver: repository.DriverMySQL,
+			urlEnv: "MYSQL_TEST_URL",
+			ddl:    "CREATE TABLE chat_message (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_read CHAR(1), send_dtm datetime, read_dtm datetime)",
+		},
+		{
+			name:   "postgres first release",
+			driver: repository.DriverPostgres,
+			urlEnv: "POSTGRES_TEST_URL",
+			ddl:    "CREATE TABLE chat_message (id BIGSERIAL PRIMARY KEY, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_read BOOLEAN, send_dtm TIMESTAMP, read_dtm TIMESTAMP)",
+		},
+		{
+			name:   "sqlite first release",
+			driver: repository.DriverSQLite,
+			urlEnv: "SQLITE_TEST_URL",
+			ddl:    "CREATE TABLE chat_message (id INTEGER PRIMARY KEY AUTOINCREMENT, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_read BOOLEAN, send_dtm DATETIME, read_dtm DATETIME)",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			url := os.Getenv(tc.urlEnv)
+			if url == "" && tc.driver == repository.DriverSQLite {
+				url = "file:" + filepath.Join(t.TempDir(), "chat.db")
+			}
+			if url == "" {
+				t.Skipf("%s is not set", tc.urlEnv)
+			}
+			db, err := sql.Open(tc.driver, url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			for _, table := range []string{tableName, "chat_outbox", "chat_room_member", "chat_room", "chat_message"} {
+				_, err = db.Exec("DROP TABLE IF EXISTS " + table)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = db.Exec(tc.ddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := time.Now().UTC().Truncate(time.Second)
+			insert := repository.Rebind(tc.driver, "INSERT INTO chat_message (receiver_id, sender_id, msg, is_read, send_dtm, read_dtm) VALUES (?, ?, ?, ?, ?, ?)")
+			_, err = db.Exec(insert, "uefa", "fifa", "read", true, n, n)
+			assert.Nil(t, err)
+			_, err = db.Exec(insert, "uefa", "fifa", "unread", false, n, nil)
+			assert.Nil(t, err)
+
+			m, err := New(db, tc.driver)
+			assert.Nil(t, err)
+			_, err = m.Up(ctx)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			repo := repository.NewMessage(db, config.Env{DBDriver: tc.driver, DBTimeout: 3000})
+			entities, err := repo.FindConversation(ctx, "uefa", "fifa", 0, 10)
+			assert.Nil(t, err)
+			if assert.Len(t, entities, 2) {
+				//newest first, read message of earlier release counts as delivered
+				assert.Equal(t, "unread", entities[0].Message)
+				assert.False(t, entities[0].IsDelivered)
+				assert.Equal(t, "read", entities[1].Message)
+				assert.True(t, entities[1].IsDelivered)
+				assert.NotNil(t, entities[1].DeliveredDtm)
+			}
+
+			//unique key covers sender, receiver and client id after upgrade
+			_, err = repo.Create(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &n})
+			assert.Nil(t, err)
+			_, err = repo.Create(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &n})
+			assert.Equal(t, repository.ErrDuplicate, err)
+			_, err = repo.Create(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "afc", Message: "hi", SendDtm: &n})
+			assert.Nil(t, err)
+		})
+	}
+}
@@ -0,0 +1,5 @@
+-- baseline schema, IF NOT EXISTS adopts existing tables and the baseline hook upgrades chat_message of earlier releases
+CREATE TABLE IF NOT EXISTS chat_message (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, client_msg_id VARCHAR(64), room_id BIGINT, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_delivered CHAR(1), is_read CHAR(1), send_dtm datetime, delivered_dtm datetime, read_dtm datetime, UNIQUE KEY uq_sender_client_msg (sender_id, receiver_id, client_msg_id));
+CREATE TABLE IF NOT EXISTS chat_room (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, name VARCHAR(100) NOT NULL, created_by VARCHAR(50) NOT NULL, created_dtm datetime);
+CREATE TABLE IF NOT EXISTS chat_room_member (room_id BIGINT NOT NULL, user_id VARCHAR(50) NOT NULL, role VARCHAR(10) NOT NULL, joined_dtm datetime, PRIMARY KEY (room_id, user_id), KEY idx_member_user (user_id));
+CREATE TABLE IF NOT EXISTS chat_outbox (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, message_id BIGINT NOT NULL, receiver_id VARCHAR(50) NOT NULL, client_msg_id VARCHAR(64), attempts INT NOT NULL DEFAULT 0, next_attempt_dtm datetime NOT NULL, dispatched_dtm datetime, created_dtm datetime, KEY idx_outbox_pending (dispatched_dtm, next_attempt_dtm));
@@ -0,0 +1 @@
+ALTER TABLE chat_message DROP INDEX idx_message_conversation, DROP INDEX idx_message_undelivered, DROP INDEX idx_message_unread, MODIFY is_delivered CHAR(1), MODIFY is_read CHAR(1), MODIFY send_dtm datetime, MODIFY delivered_dtm datetime, MODIFY read_dtm datetime;
@@ -0,0 +1,4 @@
+-- existing rows hold '0'/'1' written from go bool, MODIFY converts them in place, null becomes FALSE first
+UPDATE chat_message SET is_delivered = '0' WHERE is_delivered IS NULL;
+UPDATE chat_message SET is_read = '0' WHERE is_read IS NULL;
+ALTER TABLE chat_message MODIFY is_delivered BOOLEAN NOT NULL DEFAULT FALSE, MODIFY is_read BOOLEAN NOT NULL DEFAULT FALSE, MODIFY send_dtm DATETIME(6), MODIFY delivered_dtm DATETIME(6), MODIFY read_dtm DATETIME(6), ADD INDEX idx_message_unread (receiver_id, is_read, sender_id), ADD INDEX idx_message_undelivered (receiver_id, is_delivered), ADD INDEX idx_message_conversation (sender_id, receiver_id, id);
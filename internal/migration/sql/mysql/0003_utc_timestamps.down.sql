@@ -0,0 +1,4 @@
+UPDATE chat_message SET send_dtm = CONVERT_TZ(send_dtm, '+00:00', 'SYSTEM'), delivered_dtm = CONVERT_TZ(delivered_dtm, '+00:00', 'SYSTEM'), read_dtm = CONVERT_TZ(read_dtm, '+00:00', 'SYSTEM');
+UPDATE chat_room SET created_dtm = CONVERT_TZ(created_dtm, '+00:00', 'SYSTEM');
+UPDATE chat_room_member SET joined_dtm = CONVERT_TZ(joined_dtm, '+00:00', 'SYSTEM');
+UPDATE chat_outbox SET next_attempt_dtm = CONVERT_TZ(next_attempt_dtm, '+00:00', 'SYSTEM'), dispatched_dtm = CONVERT_TZ(dispatched_dtm, '+00:00', 'SYSTEM'), created_dtm = CONVERT_TZ(created_dtm, '+00:00', 'SYSTEM');
@@ -0,0 +1,6 @@
+-- timestamps were written with loc=Local, the service and database host are assumed to share the system zone
+-- only dml here so the conversion commits together with its version record and a retry never shifts twice
+UPDATE chat_message SET send_dtm = CONVERT_TZ(send_dtm, 'SYSTEM', '+00:00'), delivered_dtm = CONVERT_TZ(delivered_dtm, 'SYSTEM', '+00:00'), read_dtm = CONVERT_TZ(read_dtm, 'SYSTEM', '+00:00');
+UPDATE chat_room SET created_dtm = CONVERT_TZ(created_dtm, 'SYSTEM', '+00:00');
+UPDATE chat_room_member SET joined_dtm = CONVERT_TZ(joined_dtm, 'SYSTEM', '+00:00');
+UPDATE chat_outbox SET next_attempt_dtm = CONVERT_TZ(next_attempt_dtm, 'SYSTEM', '+00:00'), dispatched_dtm = CONVERT_TZ(dispatched_dtm, 'SYSTEM', '+00:00'), created_dtm = CONVERT_TZ(created_dtm, 'SYSTEM', '+00:00');
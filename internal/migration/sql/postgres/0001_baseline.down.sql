@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS chat_outbox;
+DROP TABLE IF EXISTS chat_room_member;
+DROP TABLE IF EXISTS chat_room;
+DROP TABLE IF EXISTS chat_message;
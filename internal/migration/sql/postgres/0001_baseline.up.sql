@@ -0,0 +1,7 @@
+-- baseline schema, IF NOT EXISTS adopts existing tables and the baseline hook upgrades chat_message of earlier releases
+CREATE TABLE IF NOT EXISTS chat_message (id BIGSERIAL PRIMARY KEY, client_msg_id VARCHAR(64), room_id BIGINT, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_delivered BOOLEAN NOT NULL DEFAULT FALSE, is_read BOOLEAN NOT NULL DEFAULT FALSE, send_dtm TIMESTAMP, delivered_dtm TIMESTAMP, read_dtm TIMESTAMP, CONSTRAINT uq_sender_client_msg UNIQUE (sender_id, receiver_id, client_msg_id));
+CREATE TABLE IF NOT EXISTS chat_room (id BIGSERIAL PRIMARY KEY, name VARCHAR(100) NOT NULL, created_by VARCHAR(50) NOT NULL, created_dtm TIMESTAMP);
+CREATE TABLE IF NOT EXISTS chat_room_member (room_id BIGINT NOT NULL, user_id VARCHAR(50) NOT NULL, role VARCHAR(10) NOT NULL, joined_dtm TIMESTAMP, PRIMARY KEY (room_id, user_id));
+CREATE INDEX IF NOT EXISTS idx_member_user ON chat_room_member (user_id);
+CREATE TABLE IF NOT EXISTS chat_outbox (id BIGSERIAL PRIMARY KEY, message_id BIGINT NOT NULL, receiver_id VARCHAR(50) NOT NULL, client_msg_id VARCHAR(64), attempts INT NOT NULL DEFAULT 0, next_attempt_dtm TIMESTAMP NOT NULL, dispatched_dtm TIMESTAMP, created_dtm TIMESTAMP);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON chat_outbox (dispatched_dtm, next_attempt_dtm);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_conversation;
+DROP INDEX IF EXISTS idx_message_undelivered;
+DROP INDEX IF EXISTS idx_message_unread;
@@ -0,0 +1,4 @@
+-- flags are boolean and timestamps keep microseconds since the baseline, only the lookup indexes are missing
+CREATE INDEX IF NOT EXISTS idx_message_unread ON chat_message (receiver_id, is_read, sender_id);
+CREATE INDEX IF NOT EXISTS idx_message_undelivered ON chat_message (receiver_id, is_delivered);
+CREATE INDEX IF NOT EXISTS idx_message_conversation ON chat_message (sender_id, receiver_id, id);
@@ -0,0 +1,4 @@
+UPDATE chat_message SET send_dtm = send_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone'), delivered_dtm = delivered_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone'), read_dtm = read_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE chat_room SET created_dtm = created_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE chat_room_member SET joined_dtm = joined_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE chat_outbox SET next_attempt_dtm = next_attempt_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone'), dispatched_dtm = dispatched_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone'), created_dtm = created_dtm AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,5 @@
+-- timestamps were written in the service local zone, the service and database are assumed to share TimeZone
+UPDATE chat_message SET send_dtm = send_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC', delivered_dtm = delivered_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC', read_dtm = read_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE chat_room SET created_dtm = created_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE chat_room_member SET joined_dtm = joined_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE chat_outbox SET next_attempt_dtm = next_attempt_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC', dispatched_dtm = dispatched_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC', created_dtm = created_dtm AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
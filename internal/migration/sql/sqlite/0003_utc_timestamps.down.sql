@@ -0,0 +1 @@
+-- nothing to revert
@@ -0,0 +1 @@
+-- sqlite keeps the zone offset with every value so nothing is shifted, version is kept in step with the other dialects
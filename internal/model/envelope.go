@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EnvelopeVersion is the current wire protocol version
+const EnvelopeVersion = 1
+
+const (
+	KindChat     = "chat"
+	KindAck      = "ack"
+	KindError    = "error"
+	KindTyping   = "typing"
+	KindPresence = "presence"
+	KindRead     = "read"
+	KindPing     = "ping"
+	KindPong     = "pong"
+
+	//KindTypingStart and KindTypingStop are sent by client, receiver gets KindTyping with state
+	KindTypingStart = "typing_start"
+	KindTypingStop  = "typing_stop"
+)
+
+// Envelope wraps every frame exchanged over the websocket, payload depends on type
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Id      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+const (
+	StateDelivered = "delivered"
+	StateStored    = "stored"
+)
+
+type AckPayload struct {
+	ClientMsgId string    `json:"clientMsgId,omitempty"`
+	MsgId       int64     `json:"msgId"`
+	ServerDtm   time.Time `json:"serverDtm"`
+	State       string    `json:"state"`
+}
+
+// ReadPayload marks messages read either by ids or everything from peer up to untilId,
+// the same payload is relayed to original sender with readerId and readDtm filled
+type ReadPayload struct {
+	Ids      []int64    `json:"ids,omitempty"`
+	Peer     string     `json:"peer,omitempty"`
+	UntilId  int64      `json:"untilId,omitempty"`
+	ReaderId string     `json:"readerId,omitempty"`
+	ReadDtm  *time.Time `json:"readDtm,omitempty"`
+}
+
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// TypingPayload targets either receiverId or roomId, userId and state are filled by server when relayed
+type TypingPayload struct {
+	ReceiverId string `json:"receiverId,omitempty"`
+	RoomId     int64  `json:"roomId,omitempty"`
+	UserId     string `json:"userId,omitempty"`
+	State      string `json:"state,omitempty"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewEnvelope(kind, id string, payload interface{}) (Envelope, error) {
+	e := Envelope{
+		Version: EnvelopeVersion,
+		Type:    kind,
+		Id:      id,
+	}
+	if payload == nil {
+		return e, nil
+	}
+	j, err := json.Marshal(payload)
+	if err != nil {
+		return e, err
+	}
+	e.Payload = j
+	return e, nil
+}
@@ -3,8 +3,29 @@ package model
 import "time"
 
 type ChatMessage struct {
+	Id         int64      `json:"id,omitempty"`
+	RoomId     int64      `json:"roomId,omitempty"`
 	SenderId   string     `json:"senderId"`
 	ReceiverId string     `json:"receiverId"`
 	Msg        string     `json:"msg"`
 	SendDtm    *time.Time `json:"send_dtm"`
 }
+
+type HistoryMessage struct {
+	ChatMessage
+	IsDelivered  bool       `json:"isDelivered"`
+	IsRead       bool       `json:"isRead"`
+	DeliveredDtm *time.Time `json:"deliveredDtm,omitempty"`
+	ReadDtm      *time.Time `json:"readDtm,omitempty"`
+}
+
+type HistoryPage struct {
+	Messages   []HistoryMessage `json:"messages"`
+	NextBefore int64            `json:"nextBefore,omitempty"`
+}
+
+type ConversationSummary struct {
+	PeerId      string         `json:"peerId"`
+	LastMessage HistoryMessage `json:"lastMessage"`
+	UnreadCount int64          `json:"unreadCount"`
+}
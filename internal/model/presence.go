@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+type Presence struct {
+	UserId   string     `json:"userId"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+// PresenceRequest is sent by client to start or stop receiving presence of users or every member of a room
+type PresenceRequest struct {
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+	RoomId      int64    `json:"roomId,omitempty"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// SystemSender is the sender of messages generated by server such as membership changes
+const SystemSender = "system"
+
+type Room struct {
+	Id         int64        `json:"id"`
+	Name       string       `json:"name"`
+	CreatedBy  string       `json:"createdBy"`
+	CreatedDtm *time.Time   `json:"createdDtm"`
+	Members    []RoomMember `json:"members"`
+}
+
+type RoomMember struct {
+	UserId    string     `json:"userId"`
+	Role      string     `json:"role"`
+	JoinedDtm *time.Time `json:"joinedDtm,omitempty"`
+}
+
+type CreateRoomRequest struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type AddMemberRequest struct {
+	UserId string `json:"userId"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
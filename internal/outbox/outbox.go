@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/delivery"
+	"chat-session/internal/repository"
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// claimLease keeps a claimed row away from other relays while it is being published
+const claimLease = 30 * time.Second
+
+type Relay interface {
+	//Start polls outbox in background until Stop
+	Start()
+	//Stop waits the current batch to finish
+	Stop()
+}
+
+type relay struct {
+	outboxRepo   repository.Outbox
+	delivery     delivery.Service
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	retention    time.Duration
+	purgeEvery   time.Duration
+	purged       time.Time
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stop         chan struct{}
+	done         chan struct{}
+	once         sync.Once
+}
+
+func NewRelay(outboxRepo repository.Outbox, delivery delivery.Service, env config.Env) Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &relay{
+		outboxRepo:   outboxRepo,
+		delivery:     delivery,
+		pollInterval: time.Duration(env.OutboxPollInterval) * time.Millisecond,
+		batchSize:    env.OutboxBatchSize,
+		maxAttempts:  env.OutboxMaxAttempts,
+		backoff:      time.Duration(env.OutboxBackoff) * time.Millisecond,
+		maxBackoff:   time.Duration(env.OutboxMaxBackoff) * time.Millisecond,
+		retention:    time.Duration(env.OutboxRetention) * time.Millisecond,
+		purgeEvery:   time.Duration(env.OutboxPurgeInterval) * time.Millisecond,
+		ctx:          ctx,
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+func (r *relay) Start() {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.relay()
+				r.purge()
+			}
+		}
+	}()
+}
+
+func (r *relay) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+	r.cancel()
+}
+
+func (r *relay) relay() {
+	n := time.Now()
+	entities, err := r.outboxRepo.FindPending(r.ctx, n, r.batchSize)
+	if err != nil {
+		zap.S().Errorf("r.outboxRepo.FindPending: %v", err)
+		return
+	}
+	for _, entity := range entities {
+		claimed, err := r.outboxRepo.Claim(r.ctx, entity, n.Add(claimLease))
+		if err != nil {
+			zap.S().Errorf("r.outboxRepo.Claim: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		r.dispatch(entity)
+	}
+}
+
+// purge deletes rows dispatched longer than retention ago, at most once per purge interval
+func (r *relay) purge() {
+	//zero retention keeps dispatched rows forever
+	if r.retention <= 0 {
+		return
+	}
+	n := time.Now()
+	if n.Sub(r.purged) < r.purgeEvery {
+		return
+	}
+	r.purged = n
+	deleted, err := r.outboxRepo.PurgeDispatched(r.ctx, n.Add(-r.retention))
+	if err != nil {
+		zap.S().Errorf("r.outboxRepo.PurgeDispatched: %v", err)
+		return
+	}
+	if deleted > 0 {
+		zap.S().Infof("purged %d dispatched outbox rows", deleted)
+	}
+}
+
+func (r *relay) dispatch(entity repository.OutboxEntity) {
+	//offline receiver is fine, message is stored as undelivered and fetched on reconnect
+	_, err := r.delivery.PublishRef(r.ctx, entity.ReceiverId, entity.MessageId, entity.ClientMsgId)
+	if err == nil {
+		err = r.outboxRepo.MarkDispatched(r.ctx, entity.Id, time.Now())
+		if err != nil {
+			zap.S().Errorf("r.outboxRepo.MarkDispatched: %v", err)
+		}
+		return
+	}
+
+	attempts := entity.Attempts + 1
+	if attempts >= r.maxAttempts {
+		//give up live push, the message itself stays undelivered in database
+		zap.S().Errorf("give up outbox %d of message %d after %d attempts: %v", entity.Id, entity.MessageId, attempts, err)
+		err = r.outboxRepo.MarkDispatched(r.ctx, entity.Id, time.Now())
+		if err != nil {
+			zap.S().Errorf("r.outboxRepo.MarkDispatched: %v", err)
+		}
+		return
+	}
+
+	zap.S().Warnf("publish outbox %d failed, attempt %d: %v", entity.Id, attempts, err)
+	err = r.outboxRepo.Retry(r.ctx, entity.Id, attempts, time.Now().Add(backoff(r.backoff, r.maxBackoff, attempts)))
+	if err != nil {
+		zap.S().Errorf("r.outboxRepo.Retry: %v", err)
+	}
+}
+
+// backoff doubles the base delay on every attempt up to max
+func backoff(base, max time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
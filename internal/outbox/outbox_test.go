@@ -0,0 +1,151 @@
+package outbox
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/repository"
+	"chat-session/internal/tests/mock_delivery"
+	"chat-session/internal/tests/mock_repository"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_backoff(t *testing.T) {
+	tt := []struct {
+		name     string
+		attempts int
+		expected time.Duration
+	}{
+		{
+			name:     "should return base delay on first attempt",
+			attempts: 1,
+			expected: time.Second,
+		},
+		{
+			name:     "should double delay on every attempt",
+			attempts: 3,
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "should cap delay at max",
+			attempts: 10,
+			expected: time.Minute,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, backoff(time.Second, time.Minute, tc.attempts))
+		})
+	}
+}
+
+func Test_relay(t *testing.T) {
+	entity := repository.OutboxEntity{Id: 7, MessageId: 42, ReceiverId: "uefa", ClientMsgId: "c-1", Attempts: 1}
+	tt := []struct {
+		name   string
+		expect func(repo *mock_repository.MockOutbox, d *mock_delivery.MockService)
+	}{
+		{
+			name: "should skip row claimed by another relay",
+			expect: func(repo *mock_repository.MockOutbox, d *mock_delivery.MockService) {
+				repo.EXPECT().Claim(gomock.Any(), entity, gomock.Any()).Return(false, nil)
+			},
+		},
+		{
+			name: "should skip row when claim fails",
+			expect: func(repo *mock_repository.MockOutbox, d *mock_delivery.MockService) {
+				repo.EXPECT().Claim(gomock.Any(), entity, gomock.Any()).Return(false, errors.New("mock err"))
+			},
+		},
+		{
+			name: "should mark dispatched after publish",
+			expect: func(repo *mock_repository.MockOutbox, d *mock_delivery.MockService) {
+				repo.EXPECT().Claim(gomock.Any(), entity, gomock.Any()).Return(true, nil)
+				d.EXPECT().PublishRef(gomock.Any(), "uefa", int64(42), "c-1").Return(int64(1), nil)
+				repo.EXPECT().MarkDispatched(gomock.Any(), int64(7), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "should retry with backoff when publish fails",
+			expect: func(repo *mock_repository.MockOutbox, d *mock_delivery.MockService) {
+				repo.EXPECT().Claim(gomock.Any(), entity, gomock.Any()).Return(true, nil)
+				d.EXPECT().PublishRef(gomock.Any(), "uefa", int64(42), "c-1").Return(int64(0), errors.New("mock err"))
+				repo.EXPECT().Retry(gomock.Any(), int64(7), 2, gomock.Any()).DoAndReturn(func(_ interface{}, _ int64, _ int, next time.Time) error {
+					//second attempt waits double the base delay
+					assert.WithinDuration(t, time.Now().Add(2*time.Second), next, time.Second)
+					return nil
+				})
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mock_repository.NewMockOutbox(ctrl)
+			d := mock_delivery.NewMockService(ctrl)
+			repo.EXPECT().FindPending(gomock.Any(), gomock.Any(), 100).Return([]repository.OutboxEntity{entity}, nil)
+			tc.expect(repo, d)
+
+			r := NewRelay(repo, d, config.Env{OutboxBatchSize: 100, OutboxMaxAttempts: 3, OutboxBackoff: 1000, OutboxMaxBackoff: 60000}).(*relay)
+			r.relay()
+		})
+	}
+}
+
+func Test_relayGiveUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mock_repository.NewMockOutbox(ctrl)
+	d := mock_delivery.NewMockService(ctrl)
+	entity := repository.OutboxEntity{Id: 7, MessageId: 42, ReceiverId: "uefa", Attempts: 2}
+	repo.EXPECT().FindPending(gomock.Any(), gomock.Any(), 100).Return([]repository.OutboxEntity{entity}, nil)
+	repo.EXPECT().Claim(gomock.Any(), entity, gomock.Any()).Return(true, nil)
+	d.EXPECT().PublishRef(gomock.Any(), "uefa", int64(42), "").Return(int64(0), errors.New("mock err"))
+	//last attempt failed, row is closed instead of retried
+	repo.EXPECT().MarkDispatched(gomock.Any(), int64(7), gomock.Any()).Return(nil)
+	repo.EXPECT().Retry(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	r := NewRelay(repo, d, config.Env{OutboxBatchSize: 100, OutboxMaxAttempts: 3, OutboxBackoff: 1000, OutboxMaxBackoff: 60000}).(*relay)
+	r.relay()
+}
+
+func Test_purge(t *testing.T) {
+	tt := []struct {
+		name          string
+		retention     int
+		purgedAgo     time.Duration
+		expectedPurge bool
+	}{
+		{
+			name:          "should purge rows older than retention",
+			retention:     60000,
+			purgedAgo:     time.Hour,
+			expectedPurge: true,
+		},
+		{
+			name:      "should wait purge interval between purges",
+			retention: 60000,
+			purgedAgo: time.Second,
+		},
+		{
+			name:      "should keep rows when retention is zero",
+			purgedAgo: time.Hour,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := mock_repository.NewMockOutbox(gomock.NewController(t))
+			if tc.expectedPurge {
+				repo.EXPECT().PurgeDispatched(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, before time.Time) (int64, error) {
+					assert.WithinDuration(t, time.Now().Add(-time.Minute), before, time.Second)
+					return 3, nil
+				})
+			}
+
+			r := NewRelay(repo, nil, config.Env{OutboxRetention: tc.retention, OutboxPurgeInterval: 600000}).(*relay)
+			r.purged = time.Now().Add(-tc.purgedAgo)
+			r.purge()
+		})
+	}
+}
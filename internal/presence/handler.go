@@ -0,0 +1,60 @@
+package presence
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/response"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const maxBatch = 100
+
+type Service interface {
+	Get(w http.ResponseWriter, r *http.Request)
+}
+
+type service struct {
+	tracker Tracker
+	policy  Policy
+}
+
+func NewService(tracker Tracker, policy Policy) Service {
+	return &service{
+		tracker: tracker,
+		policy:  policy,
+	}
+}
+
+// Get returns presence of comma separated users given in query string, every user must share a room or conversation with caller
+func (s service) Get(w http.ResponseWriter, r *http.Request) {
+	var userIds []string
+	for _, userId := range strings.Split(r.URL.Query().Get("users"), ",") {
+		if userId = strings.TrimSpace(userId); userId != "" {
+			userIds = append(userIds, userId)
+		}
+	}
+	if len(userIds) == 0 || len(userIds) > maxBatch {
+		response.Error(w, http.StatusBadRequest, "users must contain 1 to 100 user ids")
+		return
+	}
+
+	forbidden, err := s.policy.Forbidden(r.Context(), auth.Username(r.Context()), userIds)
+	if err != nil {
+		zap.S().Errorf("s.policy.Forbidden: %v", err)
+		response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if len(forbidden) > 0 {
+		response.Error(w, http.StatusForbidden, "cannot see presence of "+strings.Join(forbidden, ","))
+		return
+	}
+
+	presences, err := s.tracker.Status(r.Context(), userIds)
+	if err != nil {
+		zap.S().Errorf("s.tracker.Status: %v", err)
+		response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	response.JSON(w, http.StatusOK, presences)
+}
@@ -0,0 +1,79 @@
+package presence
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/tests/mock_repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fixedAuthenticator string
+
+func (a fixedAuthenticator) Authenticate(*http.Request) (string, error) {
+	return string(a), nil
+}
+
+func Test_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	roomRepo := mock_repository.NewMockRoom(ctrl)
+	roomRepo.EXPECT().FindRoommates(gomock.Any(), "fifa", gomock.Any()).DoAndReturn(func(_ interface{}, _ string, peerIds []string) ([]string, error) {
+		return intersect(peerIds, "uefa"), nil
+	}).AnyTimes()
+	messageRepo := mock_repository.NewMockMessage(ctrl)
+	messageRepo.EXPECT().FindPeers(gomock.Any(), "fifa", gomock.Any()).DoAndReturn(func(_ interface{}, _ string, peerIds []string) ([]string, error) {
+		return intersect(peerIds, "afc"), nil
+	}).AnyTimes()
+	tracker := NewTracker(cache.NewMemory(config.Env{}), config.Env{HeartbeatTimeout: 60000})
+	h := auth.Middleware(fixedAuthenticator("fifa"))(http.HandlerFunc(NewService(tracker, NewPolicy(messageRepo, roomRepo)).Get))
+
+	tt := []struct {
+		name         string
+		users        string
+		expectedCode int
+	}{
+		{
+			name:         "should return presence of room mate and conversation peer",
+			users:        "uefa,afc",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "should return own presence",
+			users:        "fifa",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "should return forbidden when a user shares nothing with caller",
+			users:        "uefa,caf",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "should return bad request when users is empty",
+			users:        "",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/presence?users="+tc.users, nil))
+			assert.Equal(t, tc.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
+
+func intersect(ids []string, visible ...string) []string {
+	var found []string
+	for _, id := range ids {
+		for _, v := range visible {
+			if id == v {
+				found = append(found, id)
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,66 @@
+package presence
+
+import (
+	"chat-session/internal/repository"
+	"context"
+)
+
+// Policy decides whose presence a user may see, only users sharing a room or a direct conversation are visible
+type Policy interface {
+	//Forbidden returns those of peerIds userId may not see, in the given order
+	Forbidden(ctx context.Context, userId string, peerIds []string) ([]string, error)
+}
+
+type policy struct {
+	messageRepo repository.Message
+	roomRepo    repository.Room
+}
+
+func NewPolicy(messageRepo repository.Message, roomRepo repository.Room) Policy {
+	return &policy{
+		messageRepo: messageRepo,
+		roomRepo:    roomRepo,
+	}
+}
+
+func (p policy) Forbidden(ctx context.Context, userId string, peerIds []string) ([]string, error) {
+	//own presence is always visible
+	pending := make([]string, 0, len(peerIds))
+	for _, peerId := range peerIds {
+		if peerId != userId {
+			pending = append(pending, peerId)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	roommates, err := p.roomRepo.FindRoommates(ctx, userId, pending)
+	if err != nil {
+		return nil, err
+	}
+	pending = without(pending, roommates)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	peers, err := p.messageRepo.FindPeers(ctx, userId, pending)
+	if err != nil {
+		return nil, err
+	}
+	return without(pending, peers), nil
+}
+
+func without(ids, visible []string) []string {
+	seen := make(map[string]struct{}, len(visible))
+	for _, id := range visible {
+		seen[id] = struct{}{}
+	}
+	var rest []string
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			rest = append(rest, id)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,162 @@
+package presence
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/model"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	rdbSessions = "%s-sessions"
+	rdbLastSeen = "%s-lastseen"
+	rdbWatchers = "%s-watchers"
+	rdbWatching = "%s-watching"
+)
+
+const watchTTL = 24 * time.Hour
+
+type Tracker interface {
+	//Connect registers device session, it returns true when this is the first device of the user
+	Connect(ctx context.Context, userId, sessionId string) (bool, error)
+	//Refresh extends device session on heartbeat, session that is not refreshed in time is treated as offline
+	Refresh(ctx context.Context, userId, sessionId string) error
+	//Disconnect removes device session, it returns true when the last device of the user is gone
+	Disconnect(ctx context.Context, userId, sessionId string) (bool, error)
+	IsOnline(ctx context.Context, userId string) (bool, error)
+	Status(ctx context.Context, userIds []string) ([]model.Presence, error)
+	Watch(ctx context.Context, watcherId string, userIds []string) error
+	Unwatch(ctx context.Context, watcherId string, userIds []string) error
+	Watchers(ctx context.Context, userId string) ([]string, error)
+}
+
+type tracker struct {
+	cache      cache.Cache
+	sessionTTL time.Duration
+}
+
+func NewTracker(cache cache.Cache, env config.Env) Tracker {
+	return &tracker{
+		cache:      cache,
+		sessionTTL: time.Duration(env.HeartbeatTimeout) * time.Millisecond,
+	}
+}
+
+// Connect keeps device sessions in sorted set scored by expiry time, so a session of crashed pod expires by itself
+func (t tracker) Connect(ctx context.Context, userId, sessionId string) (bool, error) {
+	key := fmt.Sprintf(rdbSessions, userId)
+	err := t.cache.ZRemRangeByScore(ctx, key, "-inf", now())
+	if err != nil {
+		return false, err
+	}
+	err = t.Refresh(ctx, userId, sessionId)
+	if err != nil {
+		return false, err
+	}
+	n, err := t.cache.ZCount(ctx, key, now(), "+inf")
+	return n == 1, err
+}
+
+func (t tracker) Refresh(ctx context.Context, userId, sessionId string) error {
+	expireAt := time.Now().Add(t.sessionTTL).UnixMilli()
+	return t.cache.ZAdd(ctx, fmt.Sprintf(rdbSessions, userId), sessionId, float64(expireAt), t.sessionTTL)
+}
+
+func (t tracker) Disconnect(ctx context.Context, userId, sessionId string) (bool, error) {
+	key := fmt.Sprintf(rdbSessions, userId)
+	err := t.cache.ZRem(ctx, key, sessionId)
+	if err != nil {
+		return false, err
+	}
+	n, err := t.cache.ZCount(ctx, key, now(), "+inf")
+	if err != nil || n > 0 {
+		return false, err
+	}
+
+	//last seen has no expiry so it survives until the user comes back
+	err = t.cache.Set(ctx, fmt.Sprintf(rdbLastSeen, userId), time.Now().Format(time.RFC3339), 0)
+	if err != nil {
+		return true, err
+	}
+
+	//user who is offline cannot receive presence, drop the subscriptions
+	watching, err := t.cache.SMembers(ctx, fmt.Sprintf(rdbWatching, userId))
+	if err != nil {
+		return true, err
+	}
+	return true, t.Unwatch(ctx, userId, watching)
+}
+
+func (t tracker) IsOnline(ctx context.Context, userId string) (bool, error) {
+	n, err := t.cache.ZCount(ctx, fmt.Sprintf(rdbSessions, userId), now(), "+inf")
+	return n > 0, err
+}
+
+func (t tracker) Status(ctx context.Context, userIds []string) ([]model.Presence, error) {
+	presences := make([]model.Presence, 0, len(userIds))
+	for _, userId := range userIds {
+		p := model.Presence{UserId: userId, Status: model.StatusOffline}
+		online, err := t.IsOnline(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		if online {
+			p.Status = model.StatusOnline
+			presences = append(presences, p)
+			continue
+		}
+
+		v, err := t.cache.Get(ctx, fmt.Sprintf(rdbLastSeen, userId))
+		if err != nil && err != cache.ErrNil {
+			return nil, err
+		}
+		if lastSeen, err := time.Parse(time.RFC3339, v); err == nil {
+			p.LastSeen = &lastSeen
+		}
+		presences = append(presences, p)
+	}
+	return presences, nil
+}
+
+// Watch subscribes watcher to presence change of users, reverse set is kept so it can be cleaned when watcher goes offline
+func (t tracker) Watch(ctx context.Context, watcherId string, userIds []string) error {
+	for _, userId := range userIds {
+		if userId == watcherId {
+			continue
+		}
+		err := t.cache.SAdd(ctx, fmt.Sprintf(rdbWatchers, userId), watcherId, watchTTL)
+		if err != nil {
+			return err
+		}
+		err = t.cache.SAdd(ctx, fmt.Sprintf(rdbWatching, watcherId), userId, watchTTL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tracker) Unwatch(ctx context.Context, watcherId string, userIds []string) error {
+	for _, userId := range userIds {
+		err := t.cache.SRem(ctx, fmt.Sprintf(rdbWatchers, userId), watcherId)
+		if err != nil {
+			return err
+		}
+		err = t.cache.SRem(ctx, fmt.Sprintf(rdbWatching, watcherId), userId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tracker) Watchers(ctx context.Context, userId string) ([]string, error) {
+	return t.cache.SMembers(ctx, fmt.Sprintf(rdbWatchers, userId))
+}
+
+func now() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
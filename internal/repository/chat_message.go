@@ -1,100 +1,382 @@
 package repository
 
 import (
+	"chat-session/internal/config"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
+// ErrDuplicate is returned when unique key already exists, message Create returns it together with the original id
+var ErrDuplicate = errors.New("duplicate message")
+
 type MessageEntity struct {
-	Id         int64      `json:"id"`
-	ReceiverId string     `json:"receiver_id"`
-	SenderId   string     `json:"sender_id"`
-	Message    string     `json:"msg"`
-	IsRead     bool       `json:"is_read"`
-	SendDtm    *time.Time `json:"send_dtm"`
-	ReadDtm    *time.Time `json:"read_dtm"`
+	Id           int64      `json:"id"`
+	ClientMsgId  string     `json:"client_msg_id"`
+	RoomId       int64      `json:"room_id"`
+	ReceiverId   string     `json:"receiver_id"`
+	SenderId     string     `json:"sender_id"`
+	Message      string     `json:"msg"`
+	IsDelivered  bool       `json:"is_delivered"`
+	IsRead       bool       `json:"is_read"`
+	SendDtm      *time.Time `json:"send_dtm"`
+	DeliveredDtm *time.Time `json:"delivered_dtm"`
+	ReadDtm      *time.Time `json:"read_dtm"`
 }
 
 type Message interface {
-	Create(entity MessageEntity) error
-	FindNewMsgByReceiverId(receiverId string) ([]MessageEntity, error)
-	UpdateIsRead(ids []int64) error
+	Create(ctx context.Context, entity MessageEntity) (int64, error)
+	CreateWithOutbox(ctx context.Context, entity MessageEntity) (int64, error)
+	FindNewMsgByReceiverId(ctx context.Context, receiverId string) ([]MessageEntity, error)
+	FindByClientMsgId(ctx context.Context, senderId, receiverId, clientMsgId string) (*MessageEntity, error)
+	FindByIds(ctx context.Context, receiverId string, ids []int64) ([]MessageEntity, error)
+	FindConversation(ctx context.Context, userId, peerId string, beforeId int64, limit int) ([]MessageEntity, error)
+	FindLastMessages(ctx context.Context, userId string) ([]MessageEntity, error)
+	//FindPeers returns those of peerIds who have a direct conversation with userId
+	FindPeers(ctx context.Context, userId string, peerIds []string) ([]string, error)
+	CountUnread(ctx context.Context, receiverId string) (map[string]int64, error)
+	MarkDelivered(ctx context.Context, ids []int64, n time.Time) error
+	MarkUndelivered(ctx context.Context, ids []int64) error
+	MarkRead(ctx context.Context, receiverId string, ids []int64, n time.Time) error
+	MarkReadUntil(ctx context.Context, receiverId, senderId string, untilId int64, n time.Time) error
 }
 
+const messageColumns = "id, client_msg_id, room_id, receiver_id, sender_id, msg, is_delivered, is_read, send_dtm, delivered_dtm, read_dtm"
+
 type message struct {
 	db        *sql.DB
+	dialect   dialect
+	timeout   time.Duration
 	tableName string
 }
 
-func NewMessage(db *sql.DB) Message {
+func NewMessage(db *sql.DB, env config.Env) Message {
 	repo := &message{
 		db:        db,
+		dialect:   newDialect(env.DBDriver),
+		timeout:   time.Duration(env.DBTimeout) * time.Millisecond,
 		tableName: "chat_message",
 	}
-	repo.initTable()
 	return repo
 }
 
-func (repo message) Create(entity MessageEntity) error {
-	stmt, err := repo.db.Prepare(fmt.Sprintf("INSERT INTO %s (receiver_id, sender_id, msg, is_read, send_dtm, read_dtm) VALUES (?, ?, ?, ?, ?, ?)", repo.tableName))
+func (repo message) Create(ctx context.Context, entity MessageEntity) (int64, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	id, err := repo.insert(ctx, repo.db, entity)
+	if repo.dialect.isDuplicate(err) {
+		return repo.duplicate(ctx, entity)
+	}
+	return id, err
+}
+
+// CreateWithOutbox inserts message and its outbox row in one transaction so relay never misses a stored message
+func (repo message) CreateWithOutbox(ctx context.Context, entity MessageEntity) (int64, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := repo.insert(ctx, tx, entity)
+	if repo.dialect.isDuplicate(err) {
+		//first attempt already wrote its outbox row
+		_ = tx.Rollback()
+		return repo.duplicate(ctx, entity)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	clientMsgId := sql.NullString{String: entity.ClientMsgId, Valid: entity.ClientMsgId != ""}
+	_, err = tx.ExecContext(ctx, repo.dialect.rebind(fmt.Sprintf("INSERT INTO %s (message_id, receiver_id, client_msg_id, attempts, next_attempt_dtm, created_dtm) VALUES (?, ?, ?, 0, ?, ?)", outboxTableName)), id, entity.ReceiverId, clientMsgId, utc(entity.SendDtm), utc(entity.SendDtm))
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (repo message) insert(ctx context.Context, db execer, entity MessageEntity) (int64, error) {
+	//empty client id is stored as null so messages without id never collide on unique index
+	clientMsgId := sql.NullString{String: entity.ClientMsgId, Valid: entity.ClientMsgId != ""}
+	roomId := sql.NullInt64{Int64: entity.RoomId, Valid: entity.RoomId != 0}
+	return repo.dialect.insert(ctx, db, fmt.Sprintf("INSERT INTO %s (client_msg_id, room_id, receiver_id, sender_id, msg, is_delivered, is_read, send_dtm, delivered_dtm, read_dtm) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", repo.tableName), clientMsgId, roomId, entity.ReceiverId, entity.SenderId, entity.Message, entity.IsDelivered, entity.IsRead, utc(entity.SendDtm), utc(entity.DeliveredDtm), utc(entity.ReadDtm))
+}
+
+// duplicate returns the original id of retried message instead of creating another row
+func (repo message) duplicate(ctx context.Context, entity MessageEntity) (int64, error) {
+	origin, err := repo.FindByClientMsgId(ctx, entity.SenderId, entity.ReceiverId, entity.ClientMsgId)
+	if err != nil {
+		return 0, err
+	}
+	if origin == nil {
+		return 0, ErrDuplicate
+	}
+	return origin.Id, ErrDuplicate
+}
+
+func (repo message) FindByClientMsgId(ctx context.Context, senderId, receiverId, clientMsgId string) (*MessageEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	entities, err := repo.query(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE sender_id = ? AND receiver_id = ? AND client_msg_id = ?", messageColumns, repo.tableName), senderId, receiverId, clientMsgId)
+	if err != nil || len(entities) == 0 {
+		return nil, err
+	}
+	return &entities[0], nil
+}
+
+func (repo message) FindNewMsgByReceiverId(ctx context.Context, receiverId string) ([]MessageEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	return repo.query(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE receiver_id = ? AND is_delivered = FALSE", messageColumns, repo.tableName), receiverId)
+}
+
+func (repo message) FindByIds(ctx context.Context, receiverId string, ids []int64) ([]MessageEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	in, args := inParams(ids)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE receiver_id = ? AND id IN (%s)", messageColumns, repo.tableName, in)
+	return repo.query(ctx, query, append([]interface{}{receiverId}, args...)...)
+}
+
+// FindConversation returns messages between both users newest first, beforeId zero means start from latest message
+func (repo message) FindConversation(ctx context.Context, userId, peerId string, beforeId int64, limit int) ([]MessageEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND room_id IS NULL", messageColumns, repo.tableName)
+	args := []interface{}{userId, peerId, peerId, userId}
+	if beforeId > 0 {
+		query += " AND id < ?"
+		args = append(args, beforeId)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	return repo.query(ctx, query, append(args, limit)...)
+}
+
+// FindLastMessages returns the latest message of every direct conversation the user is part of, newest first
+func (repo message) FindLastMessages(ctx context.Context, userId string) ([]MessageEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id IN (SELECT MAX(id) FROM %s WHERE (sender_id = ? OR receiver_id = ?) AND room_id IS NULL GROUP BY CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END) ORDER BY id DESC", messageColumns, repo.tableName, repo.tableName)
+	return repo.query(ctx, query, userId, userId, userId)
+}
+
+func (repo message) FindPeers(ctx context.Context, userId string, peerIds []string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(peerIds) == 0 {
+		return nil, nil
+	}
+	in, args := inParams(peerIds)
+	query := fmt.Sprintf("SELECT receiver_id FROM %s WHERE sender_id = ? AND receiver_id IN (%s) AND room_id IS NULL UNION SELECT sender_id FROM %s WHERE receiver_id = ? AND sender_id IN (%s) AND room_id IS NULL", repo.tableName, in, repo.tableName, in)
+	args = append(append([]interface{}{userId}, args...), append([]interface{}{userId}, args...)...)
+	return queryStrings(ctx, repo.db, repo.dialect, query, args...)
+}
+
+// CountUnread returns number of unread messages of receiver grouped by sender
+func (repo message) CountUnread(ctx context.Context, receiverId string) (map[string]int64, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("SELECT sender_id, COUNT(*) FROM %s WHERE receiver_id = ? AND is_read = FALSE AND room_id IS NULL GROUP BY sender_id", repo.tableName)))
+	if err != nil {
+		return nil, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(entity.ReceiverId, entity.SenderId, entity.Message, entity.IsRead, entity.SendDtm, entity.ReadDtm)
-	return err
+	r, err := stmt.QueryContext(ctx, receiverId)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	counts := make(map[string]int64)
+	for r.Next() {
+		var senderId string
+		var count int64
+		err = r.Scan(&senderId, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[senderId] = count
+	}
+	return counts, r.Err()
 }
 
-func (repo message) FindNewMsgByReceiverId(receiverId string) ([]MessageEntity, error) {
-	stmt, err := repo.db.Prepare(fmt.Sprintf("SELECT id, receiver_id, sender_id, msg, send_dtm FROM %s WHERE receiver_id = ? AND is_read = 0", repo.tableName))
+func (repo message) MarkDelivered(ctx context.Context, ids []int64, n time.Time) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := inParams(ids)
+	query := fmt.Sprintf("UPDATE %s SET is_delivered = TRUE, delivered_dtm = ? WHERE id IN (%s) AND is_delivered = FALSE", repo.tableName, in)
+	return repo.exec(ctx, query, append([]interface{}{n.UTC()}, args...)...)
+}
+
+// MarkUndelivered reverts delivered state of message the receiver never got, read message is left as is
+func (repo message) MarkUndelivered(ctx context.Context, ids []int64) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := inParams(ids)
+	query := fmt.Sprintf("UPDATE %s SET is_delivered = FALSE, delivered_dtm = NULL WHERE id IN (%s) AND is_read = FALSE", repo.tableName, in)
+	return repo.exec(ctx, query, args...)
+}
+
+func (repo message) MarkRead(ctx context.Context, receiverId string, ids []int64, n time.Time) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	//reading a message implies it was delivered, keep the earlier delivered time if any
+	in, args := inParams(ids)
+	query := fmt.Sprintf("UPDATE %s SET is_delivered = TRUE, delivered_dtm = COALESCE(delivered_dtm, ?), is_read = TRUE, read_dtm = ? WHERE receiver_id = ? AND id IN (%s) AND is_read = FALSE", repo.tableName, in)
+	return repo.exec(ctx, query, append([]interface{}{n.UTC(), n.UTC(), receiverId}, args...)...)
+}
+
+func (repo message) MarkReadUntil(ctx context.Context, receiverId, senderId string, untilId int64, n time.Time) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	query := fmt.Sprintf("UPDATE %s SET is_delivered = TRUE, delivered_dtm = COALESCE(delivered_dtm, ?), is_read = TRUE, read_dtm = ? WHERE receiver_id = ? AND sender_id = ? AND is_read = FALSE", repo.tableName)
+	args := []interface{}{n.UTC(), n.UTC(), receiverId, senderId}
+	if untilId > 0 {
+		query += " AND id <= ?"
+		args = append(args, untilId)
+	}
+	return repo.exec(ctx, query, args...)
+}
+
+func (repo message) query(ctx context.Context, query string, args ...interface{}) ([]MessageEntity, error) {
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(query))
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	r, err := stmt.Query(receiverId)
+	r, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
 
 	var entities []MessageEntity
 	for r.Next() {
-		var tmp MessageEntity
-		var sendDtm sql.NullTime
-		err = r.Scan(&tmp.Id, &tmp.ReceiverId, &tmp.SenderId, &tmp.Message, &sendDtm)
+		tmp, err := scanMessage(r)
 		if err != nil {
 			return nil, err
 		}
-		if sendDtm.Valid {
-			tmp.SendDtm = &sendDtm.Time
-		}
-
 		entities = append(entities, tmp)
 	}
-	return entities, nil
+	return entities, r.Err()
 }
 
-func (repo message) UpdateIsRead(ids []int64) error {
-	var params []string
-	for _, id := range ids {
-		params = append(params, fmt.Sprintf("'%v'", id))
-	}
-	query := fmt.Sprintf("UPDATE %s SET is_read = 1, read_dtm = ? WHERE id IN (%s)", repo.tableName, strings.Join(params, ","))
-	stmt, err := repo.db.Prepare(query)
+func (repo message) exec(ctx context.Context, query string, args ...interface{}) error {
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(query))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(time.Now())
+	_, err = stmt.ExecContext(ctx, args...)
 	return err
 }
 
-func (repo *message) initTable() {
-	_, err := repo.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, receiver_id VARCHAR(50) NOT NULL, sender_id VARCHAR(50) NOT NULL, msg TEXT, is_read CHAR(1), send_dtm datetime, read_dtm datetime)", repo.tableName))
+// scanMessage reads one row selected with messageColumns
+func scanMessage(r *sql.Rows) (MessageEntity, error) {
+	var tmp MessageEntity
+	var clientMsgId sql.NullString
+	var roomId sql.NullInt64
+	var sendDtm, deliveredDtm, readDtm sql.NullTime
+	err := r.Scan(&tmp.Id, &clientMsgId, &roomId, &tmp.ReceiverId, &tmp.SenderId, &tmp.Message, &tmp.IsDelivered, &tmp.IsRead, &sendDtm, &deliveredDtm, &readDtm)
+	if err != nil {
+		return tmp, err
+	}
+	tmp.ClientMsgId = clientMsgId.String
+	tmp.RoomId = roomId.Int64
+	if sendDtm.Valid {
+		tmp.SendDtm = utc(&sendDtm.Time)
+	}
+	if deliveredDtm.Valid {
+		tmp.DeliveredDtm = utc(&deliveredDtm.Time)
+	}
+	if readDtm.Valid {
+		tmp.ReadDtm = utc(&readDtm.Time)
+	}
+	return tmp, nil
+}
+
+// utc normalizes timestamp, columns have no zone so every value is stored and returned in utc
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// withTimeout bounds one repository call, zero timeout leaves ctx as is
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func inParams[T int64 | string](values []T) (string, []interface{}) {
+	params := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		params[i] = "?"
+		args[i] = v
+	}
+	return strings.Join(params, ","), args
+}
+
+// queryStrings runs query returning a single text column
+func queryStrings(ctx context.Context, db *sql.DB, d dialect, query string, args ...interface{}) ([]string, error) {
+	stmt, err := db.PrepareContext(ctx, d.rebind(query))
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	r, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var values []string
+	for r.Next() {
+		var v string
+		err = r.Scan(&v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
 	}
+	return values, r.Err()
 }
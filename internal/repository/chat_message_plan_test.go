@@ -0,0 +1,182 @@
+package repository_test
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/repository"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	seedUsers    = 50
+	seedMessages = 20000
+)
+
+// planQueries mirror the hot lookups of chat_message.go, each must be served by the index named in expectedIndex
+var planQueries = []struct {
+	name          string
+	query         string
+	args          []interface{}
+	expectedIndex string
+}{
+	{
+		name:          "undelivered by receiver",
+		query:         "SELECT id FROM chat_message WHERE receiver_id = ? AND is_delivered = FALSE",
+		args:          []interface{}{"u1"},
+		expectedIndex: "idx_message_undelivered",
+	},
+	{
+		name:          "unread count by receiver",
+		query:         "SELECT sender_id, COUNT(*) FROM chat_message WHERE receiver_id = ? AND is_read = FALSE AND room_id IS NULL GROUP BY sender_id",
+		args:          []interface{}{"u1"},
+		expectedIndex: "idx_message_unread",
+	},
+	{
+		name:          "conversation by pair",
+		query:         "SELECT id FROM chat_message WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND room_id IS NULL ORDER BY id DESC LIMIT ?",
+		args:          []interface{}{"u1", "u2", "u2", "u1", 50},
+		expectedIndex: "idx_message_conversation",
+	},
+}
+
+func Test_MessagePlan(t *testing.T) {
+	for _, d := range drivers {
+		t.Run(d.name, func(t *testing.T) {
+			db := openDB(t, d.driver, d.urlEnv)
+			seed(t, db, d.driver)
+			for _, tc := range planQueries {
+				t.Run(tc.name, func(t *testing.T) {
+					plan := explain(t, db, d.driver, tc.query, tc.args...)
+					assert.Contains(t, plan, tc.expectedIndex, plan)
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkMessage_FindNewMsgByReceiverId(b *testing.B) {
+	benchmark(b, func(ctx context.Context, repo repository.Message, i int) error {
+		_, err := repo.FindNewMsgByReceiverId(ctx, user(i))
+		return err
+	})
+}
+
+func BenchmarkMessage_CountUnread(b *testing.B) {
+	benchmark(b, func(ctx context.Context, repo repository.Message, i int) error {
+		_, err := repo.CountUnread(ctx, user(i))
+		return err
+	})
+}
+
+func BenchmarkMessage_FindConversation(b *testing.B) {
+	benchmark(b, func(ctx context.Context, repo repository.Message, i int) error {
+		_, err := repo.FindConversation(ctx, user(i), user(i+1), 0, 50)
+		return err
+	})
+}
+
+func benchmark(b *testing.B, fn func(ctx context.Context, repo repository.Message, i int) error) {
+	for _, d := range drivers {
+		b.Run(d.name, func(b *testing.B) {
+			db := openDB(b, d.driver, d.urlEnv)
+			seed(b, db, d.driver)
+			repo := repository.NewMessage(db, config.Env{DBDriver: d.driver, DBTimeout: 3000})
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := fn(ctx, repo, i)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func user(i int) string {
+	return "u" + strconv.Itoa(i%seedUsers)
+}
+
+// seed fills chat_message with conversations between seedUsers, one in ten message is still unread and undelivered
+func seed(tb testing.TB, db *sql.DB, driver string) {
+	_, err := db.Exec("DELETE FROM chat_message")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stmt, err := tx.Prepare(repository.Rebind(driver, "INSERT INTO chat_message (sender_id, receiver_id, msg, is_delivered, is_read, send_dtm) VALUES (?, ?, ?, ?, ?, ?)"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	n := time.Now().UTC()
+	for i := 0; i < seedMessages; i++ {
+		pending := i%10 == 0
+		_, err = stmt.Exec(user(i), user(i*7+1), "hi", !pending, !pending, n)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	_ = stmt.Close()
+	err = tx.Commit()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	//refresh statistics so planner sees the seeded distribution
+	switch driver {
+	case repository.DriverMySQL:
+		_, err = db.Exec("ANALYZE TABLE chat_message")
+	case repository.DriverPostgres:
+		_, err = db.Exec("ANALYZE chat_message")
+	case repository.DriverSQLite:
+		_, err = db.Exec("ANALYZE")
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// explain returns query plan as one text, every column of every row is joined
+func explain(tb testing.TB, db *sql.DB, driver, query string, args ...interface{}) string {
+	prefix := "EXPLAIN "
+	if driver == repository.DriverSQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	r, err := db.Query(prefix+repository.Rebind(driver, query), args...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer r.Close()
+
+	columns, err := r.Columns()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var lines []string
+	for r.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = r.Scan(dest...)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		var fields []string
+		for _, v := range values {
+			fields = append(fields, v.String)
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return strings.Join(lines, "\n")
+}
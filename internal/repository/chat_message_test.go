@@ -0,0 +1,77 @@
+package repository_test
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/migration"
+	"chat-session/internal/repository"
+	"chat-session/internal/repository/repotest"
+	"context"
+	"database/sql"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// drivers lists databases the suites run against, set MYSQL_TEST_URL or POSTGRES_TEST_URL to include them, sqlite runs on a temp file
+var drivers = []struct {
+	name   string
+	driver string
+	urlEnv string
+}{
+	{
+		name:   "mysql",
+		driver: repository.DriverMySQL,
+		urlEnv: "MYSQL_TEST_URL",
+	},
+	{
+		name:   "postgres",
+		driver: repository.DriverPostgres,
+		urlEnv: "POSTGRES_TEST_URL",
+	},
+	{
+		name:   "sqlite",
+		driver: repository.DriverSQLite,
+		urlEnv: "SQLITE_TEST_URL",
+	},
+}
+
+// openDB connects database of driver and migrates it to the latest version, it skips when url is not set
+func openDB(tb testing.TB, driver, urlEnv string) *sql.DB {
+	url := os.Getenv(urlEnv)
+	if url == "" && driver == repository.DriverSQLite {
+		url = "file:" + filepath.Join(tb.TempDir(), "chat.db") + "?_pragma=busy_timeout(5000)"
+	}
+	if url == "" {
+		tb.Skipf("%s is not set", urlEnv)
+	}
+	db, err := sql.Open(driver, url)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	m, err := migration.New(db, driver)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	_, err = m.Up(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func Test_Message(t *testing.T) {
+	for _, tc := range drivers {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openDB(t, tc.driver, tc.urlEnv)
+			repo := repository.NewMessage(db, config.Env{DBDriver: tc.driver, DBTimeout: 3000})
+			repotest.Message(t, db, repo)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"chat-session/internal/config"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const outboxTableName = "chat_outbox"
+
+// OutboxEntity is one pending publish of a stored message, written in the same transaction as the message
+type OutboxEntity struct {
+	Id             int64      `json:"id"`
+	MessageId      int64      `json:"message_id"`
+	ReceiverId     string     `json:"receiver_id"`
+	ClientMsgId    string     `json:"client_msg_id"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptDtm *time.Time `json:"next_attempt_dtm"`
+	DispatchedDtm  *time.Time `json:"dispatched_dtm"`
+	CreatedDtm     *time.Time `json:"created_dtm"`
+}
+
+type Outbox interface {
+	//FindPending returns undispatched rows due at n, oldest first
+	FindPending(ctx context.Context, n time.Time, limit int) ([]OutboxEntity, error)
+	//Claim moves next attempt of the row to until, false means another relay claimed it first
+	Claim(ctx context.Context, entity OutboxEntity, until time.Time) (bool, error)
+	MarkDispatched(ctx context.Context, id int64, n time.Time) error
+	Retry(ctx context.Context, id int64, attempts int, next time.Time) error
+	//PurgeDispatched deletes rows dispatched before the given time and returns how many were deleted
+	PurgeDispatched(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outbox struct {
+	db        *sql.DB
+	dialect   dialect
+	timeout   time.Duration
+	tableName string
+}
+
+func NewOutbox(db *sql.DB, env config.Env) Outbox {
+	repo := &outbox{
+		db:        db,
+		dialect:   newDialect(env.DBDriver),
+		timeout:   time.Duration(env.DBTimeout) * time.Millisecond,
+		tableName: outboxTableName,
+	}
+	return repo
+}
+
+func (repo outbox) FindPending(ctx context.Context, n time.Time, limit int) ([]OutboxEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("SELECT id, message_id, receiver_id, client_msg_id, attempts, next_attempt_dtm, created_dtm FROM %s WHERE dispatched_dtm IS NULL AND next_attempt_dtm <= ? ORDER BY id LIMIT ?", repo.tableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	r, err := stmt.QueryContext(ctx, n.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entities []OutboxEntity
+	for r.Next() {
+		var tmp OutboxEntity
+		var clientMsgId sql.NullString
+		var nextAttemptDtm, createdDtm sql.NullTime
+		err = r.Scan(&tmp.Id, &tmp.MessageId, &tmp.ReceiverId, &clientMsgId, &tmp.Attempts, &nextAttemptDtm, &createdDtm)
+		if err != nil {
+			return nil, err
+		}
+		tmp.ClientMsgId = clientMsgId.String
+		if nextAttemptDtm.Valid {
+			tmp.NextAttemptDtm = utc(&nextAttemptDtm.Time)
+		}
+		if createdDtm.Valid {
+			tmp.CreatedDtm = utc(&createdDtm.Time)
+		}
+		entities = append(entities, tmp)
+	}
+	return entities, r.Err()
+}
+
+func (repo outbox) Claim(ctx context.Context, entity OutboxEntity, until time.Time) (bool, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("UPDATE %s SET next_attempt_dtm = ? WHERE id = ? AND attempts = ? AND next_attempt_dtm = ? AND dispatched_dtm IS NULL", repo.tableName)))
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	r, err := stmt.ExecContext(ctx, until.UTC(), entity.Id, entity.Attempts, utc(entity.NextAttemptDtm))
+	if err != nil {
+		return false, err
+	}
+	affected, err := r.RowsAffected()
+	return affected == 1, err
+}
+
+func (repo outbox) MarkDispatched(ctx context.Context, id int64, n time.Time) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("UPDATE %s SET dispatched_dtm = ? WHERE id = ?", repo.tableName)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, n.UTC(), id)
+	return err
+}
+
+func (repo outbox) Retry(ctx context.Context, id int64, attempts int, next time.Time) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("UPDATE %s SET attempts = ?, next_attempt_dtm = ? WHERE id = ?", repo.tableName)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, attempts, next.UTC(), id)
+	return err
+}
+
+func (repo outbox) PurgeDispatched(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE dispatched_dtm IS NOT NULL AND dispatched_dtm < ?", repo.tableName)))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	r, err := stmt.ExecContext(ctx, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
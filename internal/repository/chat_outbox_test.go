@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_OutboxPurgeDispatched(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range drivers {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openDB(t, tc.driver, tc.urlEnv)
+			_, err := db.Exec("DELETE FROM chat_outbox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := config.Env{DBDriver: tc.driver, DBTimeout: 3000}
+			messageRepo := repository.NewMessage(db, env)
+			repo := repository.NewOutbox(db, env)
+
+			n := time.Now().UTC().Truncate(time.Second)
+			for _, receiverId := range []string{"uefa", "afc", "caf"} {
+				_, err = messageRepo.CreateWithOutbox(ctx, repository.MessageEntity{SenderId: "fifa", ReceiverId: receiverId, Message: "hi", SendDtm: &n})
+				assert.Nil(t, err)
+			}
+			pending, err := repo.FindPending(ctx, n, 10)
+			assert.Nil(t, err)
+			assert.Len(t, pending, 3)
+
+			//uefa dispatched long ago, afc just now, caf still pending
+			assert.Nil(t, repo.MarkDispatched(ctx, pending[0].Id, n.Add(-2*time.Hour)))
+			assert.Nil(t, repo.MarkDispatched(ctx, pending[1].Id, n))
+
+			deleted, err := repo.PurgeDispatched(ctx, n.Add(-time.Hour))
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), deleted)
+
+			var remaining int
+			assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM chat_outbox").Scan(&remaining))
+			assert.Equal(t, 2, remaining)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"chat-session/internal/config"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflict is returned when owner hand over finds the owner already changed by another request
+var ErrConflict = errors.New("room owner was changed concurrently")
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type RoomEntity struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedDtm *time.Time `json:"created_dtm"`
+}
+
+type MemberEntity struct {
+	RoomId    int64      `json:"room_id"`
+	UserId    string     `json:"user_id"`
+	Role      string     `json:"role"`
+	JoinedDtm *time.Time `json:"joined_dtm"`
+}
+
+type Room interface {
+	Create(ctx context.Context, entity RoomEntity, members []MemberEntity) (int64, error)
+	FindById(ctx context.Context, id int64) (*RoomEntity, error)
+	AddMember(ctx context.Context, entity MemberEntity) error
+	RemoveMember(ctx context.Context, roomId int64, userId string) error
+	UpdateRole(ctx context.Context, roomId int64, userId, role string) error
+	//TransferOwner makes successor owner and owner admin in one transaction
+	TransferOwner(ctx context.Context, roomId int64, ownerId, successorId string) error
+	//LeaveOwner removes owner and makes successor owner in one transaction
+	LeaveOwner(ctx context.Context, roomId int64, ownerId, successorId string) error
+	FindMember(ctx context.Context, roomId int64, userId string) (*MemberEntity, error)
+	FindMembers(ctx context.Context, roomId int64) ([]MemberEntity, error)
+	//FindRoommates returns those of peerIds who share at least one room with userId
+	FindRoommates(ctx context.Context, userId string, peerIds []string) ([]string, error)
+}
+
+type room struct {
+	db              *sql.DB
+	dialect         dialect
+	timeout         time.Duration
+	tableName       string
+	memberTableName string
+}
+
+func NewRoom(db *sql.DB, env config.Env) Room {
+	repo := &room{
+		db:              db,
+		dialect:         newDialect(env.DBDriver),
+		timeout:         time.Duration(env.DBTimeout) * time.Millisecond,
+		tableName:       "chat_room",
+		memberTableName: "chat_room_member",
+	}
+	return repo
+}
+
+// Create inserts room together with its initial members in one transaction
+func (repo room) Create(ctx context.Context, entity RoomEntity, members []MemberEntity) (int64, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := repo.dialect.insert(ctx, tx, fmt.Sprintf("INSERT INTO %s (name, created_by, created_dtm) VALUES (?, ?, ?)", repo.tableName), entity.Name, entity.CreatedBy, utc(entity.CreatedDtm))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, member := range members {
+		_, err = tx.ExecContext(ctx, repo.dialect.rebind(fmt.Sprintf("INSERT INTO %s (room_id, user_id, role, joined_dtm) VALUES (?, ?, ?, ?)", repo.memberTableName)), id, member.UserId, member.Role, utc(member.JoinedDtm))
+		if repo.dialect.isDuplicate(err) {
+			return 0, ErrDuplicate
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (repo room) FindById(ctx context.Context, id int64) (*RoomEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("SELECT id, name, created_by, created_dtm FROM %s WHERE id = ?", repo.tableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var tmp RoomEntity
+	var createdDtm sql.NullTime
+	err = stmt.QueryRowContext(ctx, id).Scan(&tmp.Id, &tmp.Name, &tmp.CreatedBy, &createdDtm)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if createdDtm.Valid {
+		tmp.CreatedDtm = utc(&createdDtm.Time)
+	}
+	return &tmp, nil
+}
+
+func (repo room) AddMember(ctx context.Context, entity MemberEntity) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("INSERT INTO %s (room_id, user_id, role, joined_dtm) VALUES (?, ?, ?, ?)", repo.memberTableName)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, entity.RoomId, entity.UserId, entity.Role, utc(entity.JoinedDtm))
+	if repo.dialect.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (repo room) RemoveMember(ctx context.Context, roomId int64, userId string) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE room_id = ? AND user_id = ?", repo.memberTableName)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, roomId, userId)
+	return err
+}
+
+func (repo room) UpdateRole(ctx context.Context, roomId int64, userId, role string) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(fmt.Sprintf("UPDATE %s SET role = ? WHERE room_id = ? AND user_id = ?", repo.memberTableName)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, role, roomId, userId)
+	return err
+}
+
+func (repo room) TransferOwner(ctx context.Context, roomId int64, ownerId, successorId string) error {
+	return repo.handOver(ctx, roomId, ownerId, successorId, fmt.Sprintf("UPDATE %s SET role = '%s' WHERE room_id = ? AND user_id = ? AND role = '%s'", repo.memberTableName, RoleAdmin, RoleOwner))
+}
+
+func (repo room) LeaveOwner(ctx context.Context, roomId int64, ownerId, successorId string) error {
+	return repo.handOver(ctx, roomId, ownerId, successorId, fmt.Sprintf("DELETE FROM %s WHERE room_id = ? AND user_id = ? AND role = '%s'", repo.memberTableName, RoleOwner))
+}
+
+// handOver runs release on the owner row and promotes successor, the room never ends up with zero or two owners
+func (repo room) handOver(ctx context.Context, roomId int64, ownerId, successorId, release string) error {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, repo.dialect.rebind(release), roomId, ownerId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+
+	res, err = tx.ExecContext(ctx, repo.dialect.rebind(fmt.Sprintf("UPDATE %s SET role = ? WHERE room_id = ? AND user_id = ?", repo.memberTableName)), RoleOwner, roomId, successorId)
+	if err != nil {
+		return err
+	}
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	//successor left meanwhile
+	if n == 0 {
+		return ErrConflict
+	}
+	return tx.Commit()
+}
+
+func (repo room) FindMember(ctx context.Context, roomId int64, userId string) (*MemberEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	members, err := repo.queryMembers(ctx, fmt.Sprintf("SELECT room_id, user_id, role, joined_dtm FROM %s WHERE room_id = ? AND user_id = ?", repo.memberTableName), roomId, userId)
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	return &members[0], nil
+}
+
+func (repo room) FindMembers(ctx context.Context, roomId int64) ([]MemberEntity, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	return repo.queryMembers(ctx, fmt.Sprintf("SELECT room_id, user_id, role, joined_dtm FROM %s WHERE room_id = ? ORDER BY joined_dtm", repo.memberTableName), roomId)
+}
+
+func (repo room) FindRoommates(ctx context.Context, userId string, peerIds []string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if len(peerIds) == 0 {
+		return nil, nil
+	}
+	in, args := inParams(peerIds)
+	query := fmt.Sprintf("SELECT DISTINCT peer.user_id FROM %s me JOIN %s peer ON peer.room_id = me.room_id WHERE me.user_id = ? AND peer.user_id IN (%s)", repo.memberTableName, repo.memberTableName, in)
+	return queryStrings(ctx, repo.db, repo.dialect, query, append([]interface{}{userId}, args...)...)
+}
+
+func (repo room) queryMembers(ctx context.Context, query string, args ...interface{}) ([]MemberEntity, error) {
+	stmt, err := repo.db.PrepareContext(ctx, repo.dialect.rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	r, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entities []MemberEntity
+	for r.Next() {
+		var tmp MemberEntity
+		var joinedDtm sql.NullTime
+		err = r.Scan(&tmp.RoomId, &tmp.UserId, &tmp.Role, &joinedDtm)
+		if err != nil {
+			return nil, err
+		}
+		if joinedDtm.Valid {
+			tmp.JoinedDtm = utc(&joinedDtm.Time)
+		}
+		entities = append(entities, tmp)
+	}
+	return entities, r.Err()
+}
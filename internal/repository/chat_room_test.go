@@ -0,0 +1,106 @@
+package repository_test
+
+import (
+	"chat-session/internal/config"
+	"chat-session/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// openRoom returns room repository over emptied room tables
+func openRoom(t *testing.T, driver, urlEnv string) repository.Room {
+	db := openDB(t, driver, urlEnv)
+	for _, table := range []string{"chat_room_member", "chat_room"} {
+		_, err := db.Exec("DELETE FROM " + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repository.NewRoom(db, config.Env{DBDriver: driver, DBTimeout: 3000})
+}
+
+func Test_RoomFindRoommates(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range drivers {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := openRoom(t, tc.driver, tc.urlEnv)
+			_, err := repo.Create(ctx, repository.RoomEntity{Name: "a", CreatedBy: "fifa"}, []repository.MemberEntity{{UserId: "fifa", Role: repository.RoleOwner}, {UserId: "uefa", Role: repository.RoleMember}})
+			assert.Nil(t, err)
+			_, err = repo.Create(ctx, repository.RoomEntity{Name: "b", CreatedBy: "fifa"}, []repository.MemberEntity{{UserId: "fifa", Role: repository.RoleOwner}, {UserId: "uefa", Role: repository.RoleMember}, {UserId: "afc", Role: repository.RoleMember}})
+			assert.Nil(t, err)
+			_, err = repo.Create(ctx, repository.RoomEntity{Name: "c", CreatedBy: "caf"}, []repository.MemberEntity{{UserId: "caf", Role: repository.RoleOwner}})
+			assert.Nil(t, err)
+
+			roommates, err := repo.FindRoommates(ctx, "fifa", []string{"uefa", "afc", "caf"})
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, []string{"uefa", "afc"}, roommates)
+		})
+	}
+}
+
+func Test_RoomHandOver(t *testing.T) {
+	ctx := context.Background()
+	tt := []struct {
+		name          string
+		leave         bool
+		ownerId       string
+		successorId   string
+		expectedErr   error
+		expectedRoles map[string]string
+	}{
+		{
+			name:          "should swap owner and successor when owner transfers",
+			ownerId:       "fifa",
+			successorId:   "uefa",
+			expectedRoles: map[string]string{"fifa": repository.RoleAdmin, "uefa": repository.RoleOwner, "afc": repository.RoleMember},
+		},
+		{
+			name:          "should remove owner and promote successor when owner leaves",
+			leave:         true,
+			ownerId:       "fifa",
+			successorId:   "uefa",
+			expectedRoles: map[string]string{"uefa": repository.RoleOwner, "afc": repository.RoleMember},
+		},
+		{
+			name:          "should change nothing when caller is no longer owner",
+			ownerId:       "afc",
+			successorId:   "uefa",
+			expectedErr:   repository.ErrConflict,
+			expectedRoles: map[string]string{"fifa": repository.RoleOwner, "uefa": repository.RoleMember, "afc": repository.RoleMember},
+		},
+		{
+			name:          "should keep owner when successor is gone",
+			leave:         true,
+			ownerId:       "fifa",
+			successorId:   "caf",
+			expectedErr:   repository.ErrConflict,
+			expectedRoles: map[string]string{"fifa": repository.RoleOwner, "uefa": repository.RoleMember, "afc": repository.RoleMember},
+		},
+	}
+	for _, d := range drivers {
+		t.Run(d.name, func(t *testing.T) {
+			for _, tc := range tt {
+				t.Run(tc.name, func(t *testing.T) {
+					repo := openRoom(t, d.driver, d.urlEnv)
+					roomId, err := repo.Create(ctx, repository.RoomEntity{Name: "a", CreatedBy: "fifa"}, []repository.MemberEntity{{UserId: "fifa", Role: repository.RoleOwner}, {UserId: "uefa", Role: repository.RoleMember}, {UserId: "afc", Role: repository.RoleMember}})
+					assert.Nil(t, err)
+
+					handOver := repo.TransferOwner
+					if tc.leave {
+						handOver = repo.LeaveOwner
+					}
+					assert.Equal(t, tc.expectedErr, handOver(ctx, roomId, tc.ownerId, tc.successorId))
+
+					members, err := repo.FindMembers(ctx, roomId)
+					assert.Nil(t, err)
+					roles := make(map[string]string)
+					for _, m := range members {
+						roles[m.UserId] = m.Role
+					}
+					assert.Equal(t, tc.expectedRoles, roles)
+				})
+			}
+		})
+	}
+}
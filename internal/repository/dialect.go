@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strconv"
+	"strings"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+const (
+	mysqlDuplicateEntry = 1062
+	pgUniqueViolation   = "23505"
+)
+
+// dialect keeps the differences between supported databases, queries are written with ? and rebound per driver
+type dialect struct {
+	driver string
+}
+
+func newDialect(driver string) dialect {
+	switch driver {
+	case "", DriverMySQL:
+		return dialect{driver: DriverMySQL}
+	case DriverPostgres, DriverSQLite:
+		return dialect{driver: driver}
+	}
+	panic(fmt.Sprintf("unsupported database driver: %q", driver))
+}
+
+// Rebind turns ? placeholders into $n for postgres, other drivers take the query as is
+func Rebind(driver, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (d dialect) rebind(query string) string {
+	return Rebind(d.driver, query)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insert runs insert statement and returns generated id, postgres driver has no LastInsertId so it uses RETURNING
+func (d dialect) insert(ctx context.Context, db execer, query string, args ...interface{}) (int64, error) {
+	if d.driver == DriverPostgres {
+		var id int64
+		err := db.QueryRowContext(ctx, d.rebind(query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	r, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
+
+func (d dialect) isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pgUniqueViolation
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+	return false
+}
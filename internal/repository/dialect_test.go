@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Rebind(t *testing.T) {
+	tt := []struct {
+		name     string
+		driver   string
+		query    string
+		expected string
+	}{
+		{
+			name:     "should keep question mark for mysql",
+			driver:   DriverMySQL,
+			query:    "SELECT id FROM chat_message WHERE receiver_id = ? AND id IN (?,?)",
+			expected: "SELECT id FROM chat_message WHERE receiver_id = ? AND id IN (?,?)",
+		},
+		{
+			name:     "should number placeholders for postgres",
+			driver:   DriverPostgres,
+			query:    "SELECT id FROM chat_message WHERE receiver_id = ? AND id IN (?,?)",
+			expected: "SELECT id FROM chat_message WHERE receiver_id = $1 AND id IN ($2,$3)",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Rebind(tc.driver, tc.query))
+		})
+	}
+}
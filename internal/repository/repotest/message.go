@@ -0,0 +1,186 @@
+// Package repotest holds conformance suite every repository implementation must pass, it runs against a real database
+package repotest
+
+import (
+	"chat-session/internal/repository"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Message runs the conformance suite of repository.Message, tables are cleaned before every case
+func Message(t *testing.T, db *sql.DB, repo repository.Message) {
+	ctx := context.Background()
+	//datetime column keeps microseconds
+	n := time.Now().UTC().Truncate(time.Microsecond)
+	reset := func(t *testing.T) {
+		for _, table := range []string{"chat_message", "chat_outbox"} {
+			_, err := db.Exec("DELETE FROM " + table)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	create := func(t *testing.T, sender, receiver, clientMsgId string) int64 {
+		id, err := repo.Create(ctx, repository.MessageEntity{ClientMsgId: clientMsgId, SenderId: sender, ReceiverId: receiver, Message: "hi", SendDtm: &n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	t.Run("should return stored message when create successfully", func(t *testing.T) {
+		reset(t)
+		id := create(t, "fifa", "uefa", "c-1")
+		entities, err := repo.FindByIds(ctx, "uefa", []int64{id})
+		assert.Nil(t, err)
+		if assert.Len(t, entities, 1) {
+			assert.Equal(t, "c-1", entities[0].ClientMsgId)
+			assert.Equal(t, "fifa", entities[0].SenderId)
+			assert.False(t, entities[0].IsDelivered)
+			assert.False(t, entities[0].IsRead)
+			assert.True(t, n.Equal(*entities[0].SendDtm))
+			assert.Nil(t, entities[0].DeliveredDtm)
+		}
+	})
+
+	t.Run("should keep microsecond and return utc timestamp", func(t *testing.T) {
+		reset(t)
+		local := time.Date(2023, 1, 2, 10, 4, 5, 123456000, time.FixedZone("ICT", 7*60*60))
+		id, err := repo.Create(ctx, repository.MessageEntity{SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &local})
+		assert.Nil(t, err)
+		entities, err := repo.FindByIds(ctx, "uefa", []int64{id})
+		assert.Nil(t, err)
+		if assert.Len(t, entities, 1) {
+			assert.Equal(t, local.UTC(), *entities[0].SendDtm)
+		}
+	})
+
+	t.Run("should return original id when client message id is duplicated", func(t *testing.T) {
+		reset(t)
+		id := create(t, "fifa", "uefa", "c-1")
+		dup, err := repo.Create(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &n})
+		assert.Equal(t, repository.ErrDuplicate, err)
+		assert.Equal(t, id, dup)
+
+		origin, err := repo.FindByClientMsgId(ctx, "fifa", "uefa", "c-1")
+		assert.Nil(t, err)
+		assert.Equal(t, id, origin.Id)
+	})
+
+	t.Run("should not collide when client message id is empty", func(t *testing.T) {
+		reset(t)
+		first := create(t, "fifa", "uefa", "")
+		second := create(t, "fifa", "uefa", "")
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("should write outbox row together with message", func(t *testing.T) {
+		reset(t)
+		id, err := repo.CreateWithOutbox(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &n})
+		assert.Nil(t, err)
+		var messageId int64
+		err = db.QueryRow("SELECT message_id FROM chat_outbox").Scan(&messageId)
+		assert.Nil(t, err)
+		assert.Equal(t, id, messageId)
+
+		_, err = repo.CreateWithOutbox(ctx, repository.MessageEntity{ClientMsgId: "c-1", SenderId: "fifa", ReceiverId: "uefa", Message: "hi", SendDtm: &n})
+		assert.Equal(t, repository.ErrDuplicate, err)
+		var count int
+		_ = db.QueryRow("SELECT COUNT(*) FROM chat_outbox").Scan(&count)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("should switch delivered state", func(t *testing.T) {
+		reset(t)
+		first := create(t, "fifa", "uefa", "c-1")
+		second := create(t, "fifa", "uefa", "c-2")
+		assert.Nil(t, repo.MarkDelivered(ctx, []int64{first}, n))
+
+		entities, err := repo.FindNewMsgByReceiverId(ctx, "uefa")
+		assert.Nil(t, err)
+		if assert.Len(t, entities, 1) {
+			assert.Equal(t, second, entities[0].Id)
+		}
+
+		assert.Nil(t, repo.MarkUndelivered(ctx, []int64{first}))
+		entities, err = repo.FindNewMsgByReceiverId(ctx, "uefa")
+		assert.Nil(t, err)
+		assert.Len(t, entities, 2)
+	})
+
+	t.Run("should count and mark unread message per sender", func(t *testing.T) {
+		reset(t)
+		first := create(t, "fifa", "uefa", "c-1")
+		create(t, "fifa", "uefa", "c-2")
+		third := create(t, "fifa", "uefa", "c-3")
+		create(t, "afc", "uefa", "c-1")
+
+		counts, err := repo.CountUnread(ctx, "uefa")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int64{"fifa": 3, "afc": 1}, counts)
+
+		assert.Nil(t, repo.MarkRead(ctx, "uefa", []int64{first}, n))
+		assert.Nil(t, repo.MarkReadUntil(ctx, "uefa", "fifa", third-1, n))
+		counts, err = repo.CountUnread(ctx, "uefa")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int64{"fifa": 1, "afc": 1}, counts)
+
+		entities, err := repo.FindByIds(ctx, "uefa", []int64{first})
+		assert.Nil(t, err)
+		if assert.Len(t, entities, 1) {
+			assert.True(t, entities[0].IsRead)
+			assert.True(t, entities[0].IsDelivered)
+			assert.True(t, n.Equal(*entities[0].ReadDtm))
+		}
+	})
+
+	t.Run("should page conversation newest first", func(t *testing.T) {
+		reset(t)
+		var ids []int64
+		for _, c := range []string{"c-1", "c-2", "c-3"} {
+			ids = append(ids, create(t, "fifa", "uefa", c))
+		}
+		create(t, "afc", "uefa", "c-1")
+
+		page, err := repo.FindConversation(ctx, "uefa", "fifa", 0, 2)
+		assert.Nil(t, err)
+		if assert.Len(t, page, 2) {
+			assert.Equal(t, ids[2], page[0].Id)
+			assert.Equal(t, ids[1], page[1].Id)
+		}
+		page, err = repo.FindConversation(ctx, "uefa", "fifa", ids[1], 2)
+		assert.Nil(t, err)
+		if assert.Len(t, page, 1) {
+			assert.Equal(t, ids[0], page[0].Id)
+		}
+	})
+
+	t.Run("should return latest message of every conversation", func(t *testing.T) {
+		reset(t)
+		create(t, "fifa", "uefa", "c-1")
+		last := create(t, "uefa", "fifa", "c-1")
+		other := create(t, "afc", "uefa", "c-1")
+
+		entities, err := repo.FindLastMessages(ctx, "uefa")
+		assert.Nil(t, err)
+		if assert.Len(t, entities, 2) {
+			assert.Equal(t, other, entities[0].Id)
+			assert.Equal(t, last, entities[1].Id)
+		}
+	})
+
+	t.Run("should find peers with direct conversation in both direction", func(t *testing.T) {
+		reset(t)
+		create(t, "fifa", "uefa", "c-1")
+		create(t, "afc", "fifa", "c-1")
+		_, err := repo.Create(ctx, repository.MessageEntity{RoomId: 1, SenderId: "fifa", ReceiverId: "caf", Message: "hi", SendDtm: &n})
+		assert.Nil(t, err)
+
+		peers, err := repo.FindPeers(ctx, "fifa", []string{"uefa", "afc", "caf", "ofc"})
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{"uefa", "afc"}, peers)
+	})
+}
@@ -0,0 +1,24 @@
+package response
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		zap.S().Errorf("json.Encode: %v", err)
+	}
+}
+
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, &errorBody{Error: msg})
+}
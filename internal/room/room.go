@@ -0,0 +1,334 @@
+package room
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/delivery"
+	"chat-session/internal/model"
+	"chat-session/internal/repository"
+	"chat-session/internal/response"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxNameLength = 100
+
+var roleRank = map[string]int{
+	repository.RoleMember: 1,
+	repository.RoleAdmin:  2,
+	repository.RoleOwner:  3,
+}
+
+type Service interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	AddMember(w http.ResponseWriter, r *http.Request)
+	RemoveMember(w http.ResponseWriter, r *http.Request)
+	Leave(w http.ResponseWriter, r *http.Request)
+	UpdateRole(w http.ResponseWriter, r *http.Request)
+}
+
+type service struct {
+	roomRepo repository.Room
+	delivery delivery.Service
+}
+
+func NewService(roomRepo repository.Room, delivery delivery.Service) Service {
+	return &service{
+		roomRepo: roomRepo,
+		delivery: delivery,
+	}
+}
+
+// Create makes a new room, caller becomes owner and requested users join as member
+func (s service) Create(w http.ResponseWriter, r *http.Request) {
+	username := auth.Username(r.Context())
+	var req model.CreateRoomRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Name == "" || len(req.Name) > maxNameLength {
+		response.Error(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	n := time.Now()
+	members := []repository.MemberEntity{{UserId: username, Role: repository.RoleOwner, JoinedDtm: &n}}
+	seen := map[string]bool{username: true}
+	for _, userId := range req.Members {
+		if userId == "" || seen[userId] {
+			continue
+		}
+		seen[userId] = true
+		members = append(members, repository.MemberEntity{UserId: userId, Role: repository.RoleMember, JoinedDtm: &n})
+	}
+
+	id, err := s.roomRepo.Create(r.Context(), repository.RoomEntity{Name: req.Name, CreatedBy: username, CreatedDtm: &n}, members)
+	if err != nil {
+		s.internalError(w, "s.roomRepo.Create", err)
+		return
+	}
+	s.broadcast(r.Context(), id, fmt.Sprintf("%s created the room", username))
+
+	room := model.Room{Id: id, Name: req.Name, CreatedBy: username, CreatedDtm: &n}
+	for _, member := range members {
+		room.Members = append(room.Members, toRoomMember(member))
+	}
+	response.JSON(w, http.StatusCreated, &room)
+}
+
+// Get returns room detail with members, only member can see it
+func (s service) Get(w http.ResponseWriter, r *http.Request) {
+	roomId, _, ok := s.actor(w, r)
+	if !ok {
+		return
+	}
+
+	entity, err := s.roomRepo.FindById(r.Context(), roomId)
+	if err != nil {
+		s.internalError(w, "s.roomRepo.FindById", err)
+		return
+	}
+	members, err := s.roomRepo.FindMembers(r.Context(), roomId)
+	if err != nil {
+		s.internalError(w, "s.roomRepo.FindMembers", err)
+		return
+	}
+
+	room := model.Room{Id: entity.Id, Name: entity.Name, CreatedBy: entity.CreatedBy, CreatedDtm: entity.CreatedDtm}
+	for _, member := range members {
+		room.Members = append(room.Members, toRoomMember(member))
+	}
+	response.JSON(w, http.StatusOK, &room)
+}
+
+// AddMember invites a user into the room, owner and admin only
+func (s service) AddMember(w http.ResponseWriter, r *http.Request) {
+	roomId, actor, ok := s.actor(w, r)
+	if !ok {
+		return
+	}
+	if roleRank[actor.Role] < roleRank[repository.RoleAdmin] {
+		response.Error(w, http.StatusForbidden, "only owner or admin can add member")
+		return
+	}
+
+	var req model.AddMemberRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.UserId == "" {
+		response.Error(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	n := time.Now()
+	err = s.roomRepo.AddMember(r.Context(), repository.MemberEntity{RoomId: roomId, UserId: req.UserId, Role: repository.RoleMember, JoinedDtm: &n})
+	if err == repository.ErrDuplicate {
+		response.Error(w, http.StatusConflict, "already a member")
+		return
+	}
+	if err != nil {
+		s.internalError(w, "s.roomRepo.AddMember", err)
+		return
+	}
+	s.broadcast(r.Context(), roomId, fmt.Sprintf("%s added %s", actor.UserId, req.UserId))
+	response.JSON(w, http.StatusCreated, &model.RoomMember{UserId: req.UserId, Role: repository.RoleMember, JoinedDtm: &n})
+}
+
+// RemoveMember kicks a member, caller must have higher role than the target
+func (s service) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	roomId, actor, ok := s.actor(w, r)
+	if !ok {
+		return
+	}
+	target, ok := s.target(w, r, roomId, actor)
+	if !ok {
+		return
+	}
+	if roleRank[actor.Role] < roleRank[repository.RoleAdmin] || roleRank[actor.Role] <= roleRank[target.Role] {
+		response.Error(w, http.StatusForbidden, "not allowed to remove this member")
+		return
+	}
+
+	err := s.roomRepo.RemoveMember(r.Context(), roomId, target.UserId)
+	if err != nil {
+		s.internalError(w, "s.roomRepo.RemoveMember", err)
+		return
+	}
+
+	//removed user is told as well, they are no longer a member so room broadcast would skip them
+	s.broadcast(r.Context(), roomId, fmt.Sprintf("%s removed %s", actor.UserId, target.UserId), target.UserId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Leave removes caller from the room, ownership is handed over when owner leaves
+func (s service) Leave(w http.ResponseWriter, r *http.Request) {
+	roomId, actor, ok := s.actor(w, r)
+	if !ok {
+		return
+	}
+
+	var successor *repository.MemberEntity
+	if actor.Role == repository.RoleOwner {
+		members, err := s.roomRepo.FindMembers(r.Context(), roomId)
+		if err != nil {
+			s.internalError(w, "s.roomRepo.FindMembers", err)
+			return
+		}
+		successor = nextOwner(members, actor.UserId)
+	}
+
+	//last owner leaves alone, otherwise leaving and hand over happen together so the room always keeps an owner
+	if successor == nil {
+		err := s.roomRepo.RemoveMember(r.Context(), roomId, actor.UserId)
+		if err != nil {
+			s.internalError(w, "s.roomRepo.RemoveMember", err)
+			return
+		}
+		s.broadcast(r.Context(), roomId, fmt.Sprintf("%s left the room", actor.UserId))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err := s.roomRepo.LeaveOwner(r.Context(), roomId, actor.UserId, successor.UserId)
+	if err == repository.ErrConflict {
+		response.Error(w, http.StatusConflict, "room owner was changed, try again")
+		return
+	}
+	if err != nil {
+		s.internalError(w, "s.roomRepo.LeaveOwner", err)
+		return
+	}
+	s.broadcast(r.Context(), roomId, fmt.Sprintf("%s left the room", actor.UserId))
+	s.broadcast(r.Context(), roomId, fmt.Sprintf("%s is now owner", successor.UserId))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateRole assigns role to a member, owner only. Giving owner role transfers ownership and caller becomes admin
+func (s service) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	roomId, actor, ok := s.actor(w, r)
+	if !ok {
+		return
+	}
+	if actor.Role != repository.RoleOwner {
+		response.Error(w, http.StatusForbidden, "only owner can assign role")
+		return
+	}
+	target, ok := s.target(w, r, roomId, actor)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateRoleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if _, valid := roleRank[req.Role]; err != nil || !valid {
+		response.Error(w, http.StatusBadRequest, "invalid role")
+		return
+	}
+
+	if req.Role == repository.RoleOwner {
+		err = s.roomRepo.TransferOwner(r.Context(), roomId, actor.UserId, target.UserId)
+	} else {
+		err = s.roomRepo.UpdateRole(r.Context(), roomId, target.UserId, req.Role)
+	}
+	if err == repository.ErrConflict {
+		response.Error(w, http.StatusConflict, "room owner was changed, try again")
+		return
+	}
+	if err != nil {
+		s.internalError(w, "s.roomRepo.UpdateRole", err)
+		return
+	}
+	s.broadcast(r.Context(), roomId, fmt.Sprintf("%s made %s %s", actor.UserId, target.UserId, req.Role))
+	response.JSON(w, http.StatusOK, &model.RoomMember{UserId: target.UserId, Role: req.Role, JoinedDtm: target.JoinedDtm})
+}
+
+// actor resolves room id from url and caller membership, response is written when it returns false
+func (s service) actor(w http.ResponseWriter, r *http.Request) (int64, *repository.MemberEntity, bool) {
+	roomId, err := strconv.ParseInt(chi.URLParam(r, "roomId"), 10, 64)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid room id")
+		return 0, nil, false
+	}
+
+	member, err := s.roomRepo.FindMember(r.Context(), roomId, auth.Username(r.Context()))
+	if err != nil {
+		s.internalError(w, "s.roomRepo.FindMember", err)
+		return 0, nil, false
+	}
+	if member == nil {
+		//do not reveal whether the room exists
+		response.Error(w, http.StatusNotFound, "room not found")
+		return 0, nil, false
+	}
+	return roomId, member, true
+}
+
+// target resolves member from url, caller cannot target themselves
+func (s service) target(w http.ResponseWriter, r *http.Request, roomId int64, actor *repository.MemberEntity) (*repository.MemberEntity, bool) {
+	userId := chi.URLParam(r, "userId")
+	if userId == actor.UserId {
+		response.Error(w, http.StatusBadRequest, "cannot target yourself")
+		return nil, false
+	}
+
+	member, err := s.roomRepo.FindMember(r.Context(), roomId, userId)
+	if err != nil {
+		s.internalError(w, "s.roomRepo.FindMember", err)
+		return nil, false
+	}
+	if member == nil {
+		response.Error(w, http.StatusNotFound, "member not found")
+		return nil, false
+	}
+	return member, true
+}
+
+// broadcast stores system message into the room for current members and given extra receivers
+func (s service) broadcast(ctx context.Context, roomId int64, text string, extra ...string) {
+	members, err := s.roomRepo.FindMembers(ctx, roomId)
+	if err != nil {
+		zap.S().Errorf("s.roomRepo.FindMembers: %v", err)
+		return
+	}
+	receivers := extra
+	for _, member := range members {
+		receivers = append(receivers, member.UserId)
+	}
+
+	m := model.ChatMessage{RoomId: roomId, SenderId: model.SystemSender, Msg: text}
+	_, err = s.delivery.Fanout(ctx, m, "", receivers)
+	if err != nil {
+		zap.S().Errorf("s.delivery.Fanout: %v", err)
+	}
+}
+
+func (s service) internalError(w http.ResponseWriter, op string, err error) {
+	zap.S().Errorf("%s: %v", op, err)
+	response.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// nextOwner picks the earliest admin, or the earliest member when there is no admin
+func nextOwner(members []repository.MemberEntity, leaving string) *repository.MemberEntity {
+	var successor *repository.MemberEntity
+	for i := range members {
+		m := &members[i]
+		if m.UserId == leaving {
+			continue
+		}
+		if successor == nil || roleRank[m.Role] > roleRank[successor.Role] {
+			successor = m
+		}
+	}
+	return successor
+}
+
+func toRoomMember(entity repository.MemberEntity) model.RoomMember {
+	return model.RoomMember{
+		UserId:    entity.UserId,
+		Role:      entity.Role,
+		JoinedDtm: entity.JoinedDtm,
+	}
+}
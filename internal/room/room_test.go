@@ -0,0 +1,187 @@
+package room
+
+import (
+	"chat-session/internal/auth"
+	"chat-session/internal/delivery"
+	"chat-session/internal/repository"
+	"chat-session/internal/tests/mock_delivery"
+	"chat-session/internal/tests/mock_repository"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_nextOwner(t *testing.T) {
+	tt := []struct {
+		name     string
+		members  []repository.MemberEntity
+		expected string
+	}{
+		{
+			name: "should pick earliest admin when admin exists",
+			members: []repository.MemberEntity{
+				{UserId: "owner", Role: repository.RoleOwner},
+				{UserId: "m1", Role: repository.RoleMember},
+				{UserId: "a1", Role: repository.RoleAdmin},
+				{UserId: "a2", Role: repository.RoleAdmin},
+			},
+			expected: "a1",
+		},
+		{
+			name: "should pick earliest member when no admin",
+			members: []repository.MemberEntity{
+				{UserId: "owner", Role: repository.RoleOwner},
+				{UserId: "m1", Role: repository.RoleMember},
+				{UserId: "m2", Role: repository.RoleMember},
+			},
+			expected: "m1",
+		},
+		{
+			name: "should return nil when owner is the last member",
+			members: []repository.MemberEntity{
+				{UserId: "owner", Role: repository.RoleOwner},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			successor := nextOwner(tc.members, "owner")
+			if tc.expected == "" {
+				assert.Nil(t, successor)
+				return
+			}
+			assert.Equal(t, tc.expected, successor.UserId)
+		})
+	}
+}
+
+type fixedAuthenticator string
+
+func (a fixedAuthenticator) Authenticate(*http.Request) (string, error) {
+	return string(a), nil
+}
+
+func Test_handler(t *testing.T) {
+	owner := &repository.MemberEntity{RoomId: 1, UserId: "owner", Role: repository.RoleOwner}
+	admin := &repository.MemberEntity{RoomId: 1, UserId: "admin", Role: repository.RoleAdmin}
+	member := &repository.MemberEntity{RoomId: 1, UserId: "member", Role: repository.RoleMember}
+	tt := []struct {
+		name         string
+		caller       string
+		method       string
+		path         string
+		body         string
+		members      []repository.MemberEntity
+		expect       func(repo *mock_repository.MockRoom)
+		expectedCode int
+	}{
+		{
+			name:         "should hide room from non member",
+			caller:       "stranger",
+			method:       http.MethodGet,
+			path:         "/rooms/1",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "should forbid member to add member",
+			caller:       "member",
+			method:       http.MethodPost,
+			path:         "/rooms/1/members",
+			body:         `{"userId":"afc"}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "should forbid admin to remove another admin",
+			caller:       "admin",
+			method:       http.MethodDelete,
+			path:         "/rooms/1/members/admin2",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "should forbid admin to assign role",
+			caller:       "admin",
+			method:       http.MethodPut,
+			path:         "/rooms/1/members/member/role",
+			body:         `{"role":"admin"}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "should transfer ownership in one call",
+			caller: "owner",
+			method: http.MethodPut,
+			path:   "/rooms/1/members/member/role",
+			body:   `{"role":"owner"}`,
+			expect: func(repo *mock_repository.MockRoom) {
+				repo.EXPECT().TransferOwner(gomock.Any(), int64(1), "owner", "member").Return(nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "should return conflict when ownership changed meanwhile",
+			caller: "owner",
+			method: http.MethodPut,
+			path:   "/rooms/1/members/member/role",
+			body:   `{"role":"owner"}`,
+			expect: func(repo *mock_repository.MockRoom) {
+				repo.EXPECT().TransferOwner(gomock.Any(), int64(1), "owner", "member").Return(repository.ErrConflict)
+			},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:    "should hand ownership over when owner leaves",
+			caller:  "owner",
+			method:  http.MethodPost,
+			path:    "/rooms/1/leave",
+			members: []repository.MemberEntity{*owner, *member, *admin},
+			expect: func(repo *mock_repository.MockRoom) {
+				repo.EXPECT().LeaveOwner(gomock.Any(), int64(1), "owner", "admin").Return(nil)
+			},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:    "should let last owner leave without successor",
+			caller:  "owner",
+			method:  http.MethodPost,
+			path:    "/rooms/1/leave",
+			members: []repository.MemberEntity{*owner},
+			expect: func(repo *mock_repository.MockRoom) {
+				repo.EXPECT().RemoveMember(gomock.Any(), int64(1), "owner").Return(nil)
+			},
+			expectedCode: http.StatusNoContent,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mock_repository.NewMockRoom(ctrl)
+			members := map[string]*repository.MemberEntity{"owner": owner, "admin": admin, "admin2": {RoomId: 1, UserId: "admin2", Role: repository.RoleAdmin}, "member": member}
+			repo.EXPECT().FindMember(gomock.Any(), int64(1), gomock.Any()).DoAndReturn(func(_ context.Context, _ int64, userId string) (*repository.MemberEntity, error) {
+				return members[userId], nil
+			}).AnyTimes()
+			repo.EXPECT().FindMembers(gomock.Any(), int64(1)).Return(tc.members, nil).AnyTimes()
+			if tc.expect != nil {
+				tc.expect(repo)
+			}
+			d := mock_delivery.NewMockService(ctrl)
+			d.EXPECT().Fanout(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(delivery.Result{}, nil).AnyTimes()
+
+			s := NewService(repo, d)
+			r := chi.NewRouter()
+			r.Use(auth.Middleware(fixedAuthenticator(tc.caller)))
+			r.Get("/rooms/{roomId}", s.Get)
+			r.Post("/rooms/{roomId}/members", s.AddMember)
+			r.Delete("/rooms/{roomId}/members/{userId}", s.RemoveMember)
+			r.Put("/rooms/{roomId}/members/{userId}/role", s.UpdateRole)
+			r.Post("/rooms/{roomId}/leave", s.Leave)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
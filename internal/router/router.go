@@ -1,12 +1,32 @@
 package router
 
 import (
+	"chat-session/internal/auth"
+	"chat-session/internal/conversation"
+	"chat-session/internal/presence"
+	"chat-session/internal/room"
 	"chat-session/internal/session"
 	"github.com/go-chi/chi/v5"
 )
 
-func InitRouter(ssService session.Service) *chi.Mux {
+func InitRouter(ssService session.Service, conversationService conversation.Service, roomService room.Service, presenceService presence.Service, authenticator auth.Authenticator) *chi.Mux {
 	r := chi.NewRouter()
 	r.Get("/online/{username}", ssService.Online)
+
+	//rest api, identity comes from verified token
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(authenticator))
+		r.Get("/conversations", conversationService.Inbox)
+		r.Get("/conversations/{peer}/messages", conversationService.Messages)
+
+		r.Post("/rooms", roomService.Create)
+		r.Get("/rooms/{roomId}", roomService.Get)
+		r.Post("/rooms/{roomId}/members", roomService.AddMember)
+		r.Delete("/rooms/{roomId}/members/{userId}", roomService.RemoveMember)
+		r.Put("/rooms/{roomId}/members/{userId}/role", roomService.UpdateRole)
+		r.Post("/rooms/{roomId}/leave", roomService.Leave)
+
+		r.Get("/presence", presenceService.Get)
+	})
 	return r
 }
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const (
+	errCodeInvalidMsg         = "invalid_message"
+	errCodeUnsupportedVersion = "unsupported_version"
+	errCodeUnknownType        = "unknown_type"
+	errCodeInternal           = "internal_error"
+)
+
+// Handler processes one inbound frame of a registered kind
+type Handler func(ss *SsModel, e model.Envelope) error
+
+// FrameError is returned by handler when the error should be reported back to the client as is
+type FrameError struct {
+	Code    string
+	Message string
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+type dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{
+		handlers: make(map[string]Handler),
+	}
+}
+
+func (d *dispatcher) Register(kind string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[kind] = h
+}
+
+// dispatch decodes envelope and hands it to registered handler, envelope is returned so caller can correlate the error
+func (d *dispatcher) dispatch(ss *SsModel, data []byte) (model.Envelope, error) {
+	var e model.Envelope
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return e, &FrameError{Code: errCodeInvalidMsg, Message: "invalid envelope json format"}
+	}
+	if e.Version != model.EnvelopeVersion {
+		return e, &FrameError{Code: errCodeUnsupportedVersion, Message: fmt.Sprintf("unsupported version %d", e.Version)}
+	}
+
+	d.mu.RLock()
+	h, ok := d.handlers[e.Type]
+	d.mu.RUnlock()
+	if !ok {
+		return e, &FrameError{Code: errCodeUnknownType, Message: fmt.Sprintf("unknown type %q", e.Type)}
+	}
+	return e, h(ss, e)
+}
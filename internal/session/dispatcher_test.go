@@ -0,0 +1,57 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_dispatch(t *testing.T) {
+	d := newDispatcher()
+	d.Register(model.KindPing, func(ss *SsModel, e model.Envelope) error {
+		return nil
+	})
+
+	tt := []struct {
+		name         string
+		data         string
+		expectedId   string
+		expectedCode string
+	}{
+		{
+			name:       "should call handler when type is registered",
+			data:       `{"v":1,"type":"ping","id":"c-1"}`,
+			expectedId: "c-1",
+		},
+		{
+			name:         "should return invalid message when json is malformed",
+			data:         `{"v":1,`,
+			expectedCode: errCodeInvalidMsg,
+		},
+		{
+			name:         "should return unsupported version when version mismatch",
+			data:         `{"v":2,"type":"ping","id":"c-2"}`,
+			expectedId:   "c-2",
+			expectedCode: errCodeUnsupportedVersion,
+		},
+		{
+			name:         "should return unknown type when no handler registered",
+			data:         `{"v":1,"type":"typing","id":"c-3"}`,
+			expectedId:   "c-3",
+			expectedCode: errCodeUnknownType,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := d.dispatch(&SsModel{}, []byte(tc.data))
+			assert.Equal(t, tc.expectedId, e.Id)
+			if tc.expectedCode == "" {
+				assert.Nil(t, err)
+				return
+			}
+			fe, ok := err.(*FrameError)
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectedCode, fe.Code)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"bytes"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"go.uber.org/zap"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeat pings client periodically and refreshes presence while client answers, silent connection is closed
+func (s service) heartbeat(ss *SsModel, stop chan struct{}) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if time.Since(ss.lastActive()) > s.heartbeatTimeout {
+				//reader loop fails on closed connection and marks the session offline
+				zap.S().Infof("%s session %s missed heartbeat then close connection", ss.Username, ss.SessionId)
+				_ = ss.Conn.Close()
+				return
+			}
+
+			err := s.presence.Refresh(ss.ctx, ss.Username, ss.SessionId)
+			if err != nil {
+				zap.S().Errorf("s.presence.Refresh: %v", err)
+			}
+			err = ss.ping()
+			if err != nil {
+				zap.S().Errorf("ss.ping: %v", err)
+				_ = ss.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// readClientData works like wsutil.ReadClientData but records client activity and serializes control frame replies
+func (ss *SsModel) readClientData() ([]byte, error) {
+	rd := wsutil.Reader{
+		Source:         ss.Conn,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		OnIntermediate: ss.handleControl,
+	}
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		ss.touch()
+		if hdr.OpCode.IsControl() {
+			err = ss.handleControl(hdr, &rd)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if hdr.OpCode&(ws.OpText|ws.OpBinary) == 0 {
+			err = rd.Discard()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return io.ReadAll(&rd)
+	}
+}
+
+// handleControl answers ping and close frames, reply is buffered first so it does not interleave with other writers
+func (ss *SsModel) handleControl(hdr ws.Header, r io.Reader) error {
+	var buf bytes.Buffer
+	err := wsutil.ControlHandler{
+		Src:                 r,
+		Dst:                 &buf,
+		State:               ws.StateServerSide,
+		DisableSrcCiphering: true,
+	}.Handle(hdr)
+	if buf.Len() > 0 {
+		_ = ss.writeLocked(ss.writeDeadline(), func() error {
+			_, err := ss.Conn.Write(buf.Bytes())
+			return err
+		})
+	}
+	return err
+}
+
+func (ss *SsModel) ping() error {
+	return ss.writeLocked(ss.writeDeadline(), func() error {
+		return wsutil.WriteServerMessage(ss.Conn, ws.OpPing, nil)
+	})
+}
+
+func (ss *SsModel) touch() {
+	atomic.StoreInt64(&ss.active, time.Now().UnixNano())
+}
+
+func (ss *SsModel) lastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ss.active))
+}
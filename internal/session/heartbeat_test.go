@@ -0,0 +1,39 @@
+package session
+
+import (
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_readClientData(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	ss := &SsModel{Conn: server}
+
+	go func() {
+		_ = wsutil.WriteClientMessage(client, ws.OpPing, nil)
+		_ = wsutil.WriteClientMessage(client, ws.OpText, []byte("hello"))
+	}()
+	pong := make(chan ws.OpCode, 1)
+	go func() {
+		h, _ := ws.ReadHeader(client)
+		pong <- h.OpCode
+	}()
+
+	before := time.Now()
+	data, err := ss.readClientData()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.False(t, ss.lastActive().Before(before))
+	select {
+	case op := <-pong:
+		assert.Equal(t, ws.OpPong, op)
+	case <-time.After(time.Second):
+		t.Fatal("pong not received")
+	}
+}
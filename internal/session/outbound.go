@@ -0,0 +1,166 @@
+package session
+
+import (
+	"errors"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	OverflowDropOldest = "drop_oldest"
+	OverflowDisconnect = "disconnect"
+	OverflowSpill      = "spill"
+)
+
+var (
+	errQueueFull     = errors.New("outbound queue is full")
+	errWriterStopped = errors.New("connection writer is stopped")
+)
+
+// outbound is one frame waiting for the writer, written runs after it reached the socket and spill when it is given up
+type outbound struct {
+	data    []byte
+	written func()
+	spill   func()
+}
+
+// giveUp spills frame which will never be written
+func (o outbound) giveUp() {
+	if o.spill != nil {
+		o.spill()
+	}
+}
+
+// enqueue never blocks the caller, a slow client is handled by overflow policy instead
+func (ss *SsModel) enqueue(o outbound) error {
+	//writer drains the queue only once, it waits every enqueue in progress before that
+	ss.qMu.RLock()
+	defer ss.qMu.RUnlock()
+	select {
+	case <-ss.stopped:
+		o.giveUp()
+		return errWriterStopped
+	case <-ss.ctx.Done():
+		o.giveUp()
+		return errWriterStopped
+	default:
+	}
+
+	select {
+	case ss.out <- o:
+		return nil
+	default:
+	}
+
+	switch ss.overflow {
+	case OverflowDisconnect:
+		zap.S().Warnf("%s session %s is too slow then close connection", ss.Username, ss.SessionId)
+		_ = ss.Conn.Close()
+		o.giveUp()
+		return errQueueFull
+	case OverflowSpill:
+		o.giveUp()
+		return errQueueFull
+	}
+
+	//drop oldest frame to make room, other producers may fill the slot first so give up after one try
+	select {
+	case old := <-ss.out:
+		zap.S().Warnf("%s session %s queue is full then drop oldest frame", ss.Username, ss.SessionId)
+		//dropped frame is spilled like any frame given up, so it is fetched again on reconnect
+		old.giveUp()
+	default:
+	}
+	select {
+	case ss.out <- o:
+		return nil
+	default:
+		o.giveUp()
+		return errQueueFull
+	}
+}
+
+// enqueueWait blocks until the writer takes frame, server driven replay waits for a slow client instead of hitting overflow policy
+func (ss *SsModel) enqueueWait(o outbound) error {
+	ss.qMu.RLock()
+	defer ss.qMu.RUnlock()
+	select {
+	case <-ss.stopped:
+	case <-ss.ctx.Done():
+	case ss.out <- o:
+		return nil
+	}
+	o.giveUp()
+	return errWriterStopped
+}
+
+// writeLoop is the only writer of data frames, control frames still go directly under wMu
+func (ss *SsModel) writeLoop() {
+	for {
+		//ended connection wins over a ready frame, nobody reads it anymore
+		if ss.ctx.Err() != nil {
+			ss.stopWriting()
+			return
+		}
+		select {
+		case <-ss.ctx.Done():
+			ss.stopWriting()
+			return
+		case o := <-ss.out:
+			err := ss.writeFrame(o.data)
+			if err != nil {
+				zap.S().Errorf("ss.writeFrame: %v", err)
+				_ = ss.Conn.Close()
+				o.giveUp()
+				ss.stopWriting()
+				return
+			}
+			if o.written != nil {
+				o.written()
+			}
+		}
+	}
+}
+
+// stopWriting spills every frame left in the queue, sender may already have stored it as delivered
+func (ss *SsModel) stopWriting() {
+	close(ss.stopped)
+	ss.qMu.Lock()
+	//nothing enters the queue once stopped is closed and enqueue in progress is done
+	ss.qMu.Unlock()
+	for {
+		select {
+		case o := <-ss.out:
+			o.giveUp()
+		default:
+			return
+		}
+	}
+}
+
+func (ss *SsModel) writeFrame(data []byte) error {
+	return ss.writeLocked(ss.writeDeadline(), func() error {
+		return wsutil.WriteServerMessage(ss.Conn, ws.OpText, data)
+	})
+}
+
+// writeLocked runs fn under wMu with a write deadline, a client that stops reading cannot hold wMu forever
+func (ss *SsModel) writeLocked(deadline time.Time, fn func() error) error {
+	ss.wMu.Lock()
+	defer ss.wMu.Unlock()
+	err := ss.Conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	return fn()
+}
+
+// writeDeadline bounds the next write by write timeout, zero timeout means no deadline
+func (ss *SsModel) writeDeadline() time.Time {
+	if ss.writeTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ss.writeTimeout)
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_enqueue(t *testing.T) {
+	tt := []struct {
+		name           string
+		overflow       string
+		expectedErr    error
+		expectedQueue  []string
+		expectedSpill  []string
+		expectedClosed bool
+	}{
+		{
+			name:          "should drop and spill oldest frame when queue is full",
+			overflow:      OverflowDropOldest,
+			expectedQueue: []string{"2", "3"},
+			expectedSpill: []string{"1"},
+		},
+		{
+			name:           "should close connection and spill new frame when queue is full and policy is disconnect",
+			overflow:       OverflowDisconnect,
+			expectedErr:    errQueueFull,
+			expectedQueue:  []string{"1", "2"},
+			expectedSpill:  []string{"3"},
+			expectedClosed: true,
+		},
+		{
+			name:          "should spill new frame when queue is full and policy is spill",
+			overflow:      OverflowSpill,
+			expectedErr:   errQueueFull,
+			expectedQueue: []string{"1", "2"},
+			expectedSpill: []string{"3"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			ss := &SsModel{ctx: context.Background(), Conn: server, out: make(chan outbound, 2), overflow: tc.overflow}
+			var spilled []string
+			frame := func(data string) outbound {
+				return outbound{data: []byte(data), spill: func() { spilled = append(spilled, data) }}
+			}
+			assert.Nil(t, ss.enqueue(frame("1")))
+			assert.Nil(t, ss.enqueue(frame("2")))
+
+			err := ss.enqueue(frame("3"))
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedSpill, spilled)
+
+			var queue []string
+			for len(ss.out) > 0 {
+				queue = append(queue, string((<-ss.out).data))
+			}
+			assert.Equal(t, tc.expectedQueue, queue)
+
+			_ = server.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+			_, err = server.Write([]byte("x"))
+			assert.Equal(t, tc.expectedClosed, err == io.ErrClosedPipe)
+		})
+	}
+}
+
+func Test_writeLoop(t *testing.T) {
+	tt := []struct {
+		name          string
+		failWrite     bool
+		expectedSpill []string
+	}{
+		{
+			name:          "should spill queued frames when connection ends",
+			expectedSpill: []string{"1", "2", "3"},
+		},
+		{
+			name:          "should spill failed frame and queued frames when write fails",
+			failWrite:     true,
+			expectedSpill: []string{"1", "2", "3"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			ss := &SsModel{ctx: ctx, cancel: cancel, Conn: server, out: make(chan outbound, 2), overflow: OverflowSpill, stopped: make(chan struct{})}
+			var mu sync.Mutex
+			var spilled []string
+			frame := func(data string) outbound {
+				return outbound{data: []byte(data), spill: func() {
+					mu.Lock()
+					defer mu.Unlock()
+					spilled = append(spilled, data)
+				}}
+			}
+			assert.Nil(t, ss.enqueue(frame("1")))
+			assert.Nil(t, ss.enqueue(frame("2")))
+
+			if tc.failWrite {
+				_ = client.Close()
+			} else {
+				cancel()
+			}
+			ss.writeLoop()
+			//frame enqueued after the writer stopped is spilled right away
+			assert.Equal(t, errWriterStopped, ss.enqueue(frame("3")))
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.ElementsMatch(t, tc.expectedSpill, spilled)
+			assert.Len(t, ss.out, 0)
+		})
+	}
+}
+
+func Test_writeFrameDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	ss := &SsModel{Conn: server, writeTimeout: 10 * time.Millisecond}
+
+	//client never reads, write gives up instead of holding wMu
+	err := ss.writeFrame([]byte("hello"))
+	assert.True(t, os.IsTimeout(err), err)
+	err = ss.ping()
+	assert.True(t, os.IsTimeout(err), err)
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// subscribePresence handles presence frame, client gets current status of subscribed users right away and every change later
+func (s service) subscribePresence(ss *SsModel, e model.Envelope) error {
+	var req model.PresenceRequest
+	err := json.Unmarshal(e.Payload, &req)
+	if err != nil {
+		return &FrameError{Code: errCodeInvalidMsg, Message: "invalid presence payload"}
+	}
+
+	//room members are checked below, any other user must share a room or a conversation with the watcher
+	forbidden, err := s.policy.Forbidden(ss.ctx, ss.Username, req.Subscribe)
+	if err != nil {
+		return err
+	}
+	if len(forbidden) > 0 {
+		return &FrameError{Code: errCodeForbidden, Message: "cannot see presence of " + strings.Join(forbidden, ",")}
+	}
+
+	subscribe := req.Subscribe
+	if req.RoomId != 0 {
+		member, err := s.roomRepo.FindMember(ss.ctx, req.RoomId, ss.Username)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return &FrameError{Code: errCodeForbidden, Message: "not a member of the room"}
+		}
+		members, err := s.roomRepo.FindMembers(ss.ctx, req.RoomId)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			if m.UserId != ss.Username {
+				subscribe = append(subscribe, m.UserId)
+			}
+		}
+	}
+
+	err = s.presence.Unwatch(ss.ctx, ss.Username, req.Unsubscribe)
+	if err != nil {
+		return err
+	}
+	err = s.presence.Watch(ss.ctx, ss.Username, subscribe)
+	if err != nil {
+		return err
+	}
+
+	presences, err := s.presence.Status(ss.ctx, subscribe)
+	if err != nil {
+		return err
+	}
+	for _, p := range presences {
+		out, err := model.NewEnvelope(model.KindPresence, e.Id, &p)
+		if err != nil {
+			return err
+		}
+		err = ss.send(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcastPresence tells every watcher of the user about status change
+func (s service) broadcastPresence(ctx context.Context, p model.Presence) {
+	watchers, err := s.presence.Watchers(ctx, p.UserId)
+	if err != nil {
+		zap.S().Errorf("s.presence.Watchers: %v", err)
+		return
+	}
+
+	e, err := model.NewEnvelope(model.KindPresence, "", &p)
+	if err != nil {
+		zap.S().Errorf("model.NewEnvelope: %v", err)
+		return
+	}
+	for _, watcherId := range watchers {
+		_, err = s.delivery.Publish(ctx, watcherId, e)
+		if err != nil {
+			zap.S().Errorf("s.delivery.Publish: %v", err)
+		}
+	}
+}
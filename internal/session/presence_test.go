@@ -0,0 +1,60 @@
+package session
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/model"
+	"chat-session/internal/presence"
+	"chat-session/internal/tests/mock_repository"
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_subscribePresence(t *testing.T) {
+	tt := []struct {
+		name         string
+		payload      string
+		expectedCode string
+		expectedSent int
+	}{
+		{
+			name:         "should send status of conversation peer",
+			payload:      `{"subscribe":["afc"]}`,
+			expectedSent: 1,
+		},
+		{
+			name:         "should return forbidden when user shares nothing with watcher",
+			payload:      `{"subscribe":["afc","caf"]}`,
+			expectedCode: errCodeForbidden,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			ctrl := gomock.NewController(t)
+			roomRepo := mock_repository.NewMockRoom(ctrl)
+			roomRepo.EXPECT().FindRoommates(gomock.Any(), "fifa", gomock.Any()).Return(nil, nil)
+			messageRepo := mock_repository.NewMockMessage(ctrl)
+			messageRepo.EXPECT().FindPeers(gomock.Any(), "fifa", gomock.Any()).Return([]string{"afc"}, nil)
+			tracker := presence.NewTracker(cache.NewMemory(config.Env{}), config.Env{HeartbeatTimeout: 60000})
+
+			s := service{presence: tracker, policy: presence.NewPolicy(messageRepo, roomRepo)}
+			ss := &SsModel{ctx: ctx, Username: "fifa", out: make(chan outbound, 4)}
+			err := s.subscribePresence(ss, model.Envelope{Type: model.KindPresence, Payload: []byte(tc.payload)})
+			if tc.expectedCode != "" {
+				fe, ok := err.(*FrameError)
+				assert.True(t, ok)
+				assert.Equal(t, tc.expectedCode, fe.Code)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Len(t, ss.out, tc.expectedSent)
+
+			//forbidden request must not register the watcher either
+			watchers, _ := tracker.Watchers(ctx, "afc")
+			assert.Equal(t, tc.expectedSent > 0, len(watchers) > 0)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"time"
+)
+
+// markRead handles read frame from the receiver and notifies original senders who are online
+func (s service) markRead(ss *SsModel, e model.Envelope) error {
+	var req model.ReadPayload
+	err := json.Unmarshal(e.Payload, &req)
+	if err != nil {
+		return &FrameError{Code: errCodeInvalidMsg, Message: "invalid read payload"}
+	}
+	n := time.Now()
+	defer s.invalidateUnread(ss.ctx, ss.Username)
+
+	//mark everything from peer up to given id
+	if len(req.Ids) == 0 {
+		if req.Peer == "" {
+			return &FrameError{Code: errCodeInvalidMsg, Message: "ids or peer is required"}
+		}
+		err = s.messageRepo.MarkReadUntil(ss.ctx, ss.Username, req.Peer, req.UntilId, n)
+		if err != nil {
+			return err
+		}
+		s.notifyRead(ss.ctx, req.Peer, model.ReadPayload{UntilId: req.UntilId, ReaderId: ss.Username, ReadDtm: &n})
+		return nil
+	}
+
+	//mark given ids, only messages addressed to this user are affected
+	entities, err := s.messageRepo.FindByIds(ss.ctx, ss.Username, req.Ids)
+	if err != nil {
+		return err
+	}
+	err = s.messageRepo.MarkRead(ss.ctx, ss.Username, req.Ids, n)
+	if err != nil {
+		return err
+	}
+
+	bySender := make(map[string][]int64)
+	for _, entity := range entities {
+		if entity.IsRead {
+			continue
+		}
+		bySender[entity.SenderId] = append(bySender[entity.SenderId], entity.Id)
+	}
+	for senderId, ids := range bySender {
+		s.notifyRead(ss.ctx, senderId, model.ReadPayload{Ids: ids, ReaderId: ss.Username, ReadDtm: &n})
+	}
+	return nil
+}
+
+func (s service) notifyRead(ctx context.Context, senderId string, p model.ReadPayload) {
+	e, err := model.NewEnvelope(model.KindRead, "", &p)
+	if err != nil {
+		zap.S().Errorf("model.NewEnvelope: %v", err)
+		return
+	}
+
+	//read event is best effort, read state of offline sender is kept in database
+	_, err = s.delivery.Publish(ctx, senderId, e)
+	if err != nil {
+		zap.S().Errorf("s.delivery.Publish: %v", err)
+	}
+}
+
+func (s service) invalidateUnread(ctx context.Context, userId string) {
+	err := s.unread.Invalidate(ctx, userId)
+	if err != nil {
+		zap.S().Errorf("s.unread.Invalidate: %v", err)
+	}
+}
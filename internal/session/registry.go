@@ -0,0 +1,112 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"context"
+	"errors"
+	"github.com/gobwas/ws"
+	"go.uber.org/zap"
+	"sync"
+)
+
+const goingAway = "server shutting down"
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// registry keeps live sessions and in-flight client frames so shutdown can close and wait for them
+type registry struct {
+	mu       sync.Mutex
+	sessions map[*SsModel]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+func newRegistry() *registry {
+	return &registry{
+		sessions: make(map[*SsModel]struct{}),
+	}
+}
+
+func (r *registry) add(ss *SsModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closing {
+		return errShuttingDown
+	}
+	r.sessions[ss] = struct{}{}
+	r.wg.Add(1)
+	return nil
+}
+
+func (r *registry) remove(ss *SsModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[ss]; !ok {
+		return
+	}
+	delete(r.sessions, ss)
+	r.wg.Done()
+}
+
+// track counts a frame handler of a live session or a session close of Shutdown, it is never called while wait is waiting on zero
+func (r *registry) track() func() {
+	r.wg.Add(1)
+	return r.wg.Done
+}
+
+// drain stops accepting sessions and returns the ones still connected
+func (r *registry) drain() []*SsModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closing = true
+	sessions := make([]*SsModel, 0, len(r.sessions))
+	for ss := range r.sessions {
+		sessions = append(sessions, ss)
+	}
+	return sessions
+}
+
+func (r *registry) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown tells every client the server is going away, marks them offline and waits pending frames until ctx is done
+func (s service) Shutdown(ctx context.Context) error {
+	sessions := s.registry.drain()
+	zap.S().Infof("closing %d sessions", len(sessions))
+	//sessions are closed concurrently so a client that stops reading does not hold back the others
+	for _, ss := range sessions {
+		done := s.registry.track()
+		go func(ss *SsModel) {
+			defer done()
+			err := ss.goAway(ctx)
+			if err != nil {
+				zap.S().Debugf("ss.goAway: %v", err)
+			}
+			s.setStatus(ss, model.StatusOffline)
+			_ = ss.Conn.Close()
+		}(ss)
+	}
+	return s.registry.wait(ctx)
+}
+
+// goAway writes close frame so client knows it should reconnect to another server, the write ends by ctx deadline at the latest
+func (ss *SsModel) goAway(ctx context.Context) error {
+	deadline := ss.writeDeadline()
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	return ss.writeLocked(deadline, func() error {
+		return ws.WriteFrame(ss.Conn, ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusGoingAway, goingAway)))
+	})
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/presence"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_registry(t *testing.T) {
+	r := newRegistry()
+	ss := &SsModel{}
+	assert.Nil(t, r.add(ss))
+	done := r.track()
+
+	//session and frame are still counted
+	assert.Equal(t, []*SsModel{ss}, r.drain())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.wait(ctx))
+
+	//no new session after drain
+	assert.Equal(t, errShuttingDown, r.add(&SsModel{}))
+
+	done()
+	r.remove(ss)
+	assert.Nil(t, r.wait(context.Background()))
+}
+
+func Test_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	tracker := presence.NewTracker(cache.NewMemory(config.Env{}), config.Env{HeartbeatTimeout: 60000})
+	s := service{registry: newRegistry(), presence: tracker}
+
+	//neither client reads, the close frame would block forever without a deadline
+	for _, username := range []string{"fifa", "uefa"} {
+		server, client := net.Pipe()
+		defer client.Close()
+		ss := &SsModel{ctx: ctx, Conn: server, Username: username, SessionId: username}
+		_, err := tracker.Connect(ctx, username, ss.SessionId)
+		assert.Nil(t, err)
+		assert.Nil(t, s.registry.add(ss))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(shutdownCtx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	//both sessions are marked offline even though their client is stuck
+	assert.Eventually(t, func() bool {
+		for _, username := range []string{"fifa", "uefa"} {
+			online, _ := tracker.IsOnline(ctx, username)
+			if online {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
@@ -1,60 +1,139 @@
 package session
 
 import (
+	"chat-session/internal/auth"
 	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/delivery"
 	"chat-session/internal/model"
+	"chat-session/internal/presence"
 	"chat-session/internal/repository"
+	"chat-session/internal/unread"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-redis/redis/v8"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"go.uber.org/zap"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	cannotConnect = "cannot connect"
+	//resolveAttempts bounds retry of a message that cannot be resolved, it is then left to the undelivered row
+	resolveAttempts = 3
+	resolveBackoff  = 100 * time.Millisecond
+	//maxClientMsgId is the size of chat_message.client_msg_id, a longer id would fail every insert
+	maxClientMsgId = 64
 )
 const (
-	rdbOnline      = "%s-online"
-	rdbPublish     = "%s-channel"
-	rdbUndelivered = "%s-undelivered"
-)
-const (
-	statusOnline  = "online"
-	statusOffline = "offline"
+	errCodeSenderMismatch = "sender_mismatch"
+	errCodeForbidden      = "forbidden"
+	errCodeInFlight       = "in_flight"
+	errCodeRateLimited    = "rate_limited"
 )
 
 type Service interface {
 	Online(w http.ResponseWriter, r *http.Request)
+	Register(kind string, h Handler)
+	//Shutdown closes every live connection and waits in-flight frames
+	Shutdown(ctx context.Context) error
 }
 
 type service struct {
-	cache       cache.Cache
-	messageRepo repository.Message
+	cache         cache.Cache
+	messageRepo   repository.Message
+	roomRepo      repository.Room
+	authenticator auth.Authenticator
+	unread        unread.Counter
+	delivery      delivery.Service
+	presence      presence.Tracker
+	policy        presence.Policy
+	dispatcher    *dispatcher
+	registry      *registry
+
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	typingExpiry      time.Duration
+	typingThrottle    time.Duration
+	typingRateLimit   int
+	typingMaxTargets  int
+	outboundQueue     int
+	outboundOverflow  string
+	writeTimeout      time.Duration
 }
 
-func NewService(cache cache.Cache, messageRepo repository.Message) Service {
-	return &service{
-		cache:       cache,
-		messageRepo: messageRepo,
+func NewService(cache cache.Cache, messageRepo repository.Message, roomRepo repository.Room, authenticator auth.Authenticator, unread unread.Counter, delivery delivery.Service, tracker presence.Tracker, env config.Env) Service {
+	s := &service{
+		cache:             cache,
+		messageRepo:       messageRepo,
+		roomRepo:          roomRepo,
+		authenticator:     authenticator,
+		unread:            unread,
+		delivery:          delivery,
+		presence:          tracker,
+		policy:            presence.NewPolicy(messageRepo, roomRepo),
+		dispatcher:        newDispatcher(),
+		registry:          newRegistry(),
+		heartbeatInterval: time.Duration(env.HeartbeatInterval) * time.Millisecond,
+		heartbeatTimeout:  time.Duration(env.HeartbeatTimeout) * time.Millisecond,
+		typingExpiry:      time.Duration(env.TypingExpiry) * time.Millisecond,
+		typingThrottle:    time.Duration(env.TypingThrottle) * time.Millisecond,
+		typingRateLimit:   env.TypingRateLimit,
+		typingMaxTargets:  env.TypingMaxTargets,
+		outboundQueue:     env.OutboundQueueSize,
+		outboundOverflow:  env.OutboundOverflow,
+		writeTimeout:      time.Duration(env.WriteTimeout) * time.Millisecond,
 	}
+	s.Register(model.KindChat, s.forwardMsgToReceiver)
+	s.Register(model.KindPing, s.pong)
+	s.Register(model.KindRead, s.markRead)
+	s.Register(model.KindPresence, s.subscribePresence)
+	s.Register(model.KindTypingStart, s.startTyping)
+	s.Register(model.KindTypingStop, s.stopTyping)
+	return s
+}
+
+func (s service) Register(kind string, h Handler) {
+	s.dispatcher.Register(kind, h)
 }
 
 func (s service) Online(w http.ResponseWriter, r *http.Request) {
-	ss, err := initConnection(w, r)
+	//verify identity before upgrade, after upgrade we cannot respond with http status anymore
+	username, err := s.authenticate(r)
+	if err != nil {
+		zap.S().Infof("reject connection: %v", err)
+		http.Error(w, http.StatusText(auth.StatusCode(err)), auth.StatusCode(err))
+		return
+	}
+
+	ss, err := initConnection(w, r, username, s.outboundQueue, s.outboundOverflow, s.writeTimeout)
 	if err != nil {
 		http.Error(w, cannotConnect, http.StatusInternalServerError)
 		return
 	}
+	defer ss.cancel()
+
+	//connection accepted while shutting down is closed right away, client reconnects to another server
+	err = s.registry.add(ss)
+	if err != nil {
+		_ = ss.goAway(r.Context())
+		_ = ss.Conn.Close()
+		return
+	}
+	defer s.registry.remove(ss)
+	go ss.writeLoop()
 
 	//setup status to online
-	s.setStatus(ss, statusOnline)
+	s.setStatus(ss, model.StatusOnline)
 
 	//get undelivered message while user offline
 	s.getUndeliveredMsg(ss)
@@ -65,8 +144,8 @@ func (s service) Online(w http.ResponseWriter, r *http.Request) {
 
 func (s service) getUndeliveredMsg(ss *SsModel) {
 	//get update flag from redis first. if key found then it means need to update otherwise do nothing.
-	_, err := s.cache.Get(fmt.Sprintf(rdbUndelivered, ss.Username))
-	if err == redis.Nil {
+	flag, err := s.cache.Get(ss.ctx, fmt.Sprintf(delivery.RdbUndelivered, ss.Username))
+	if err == cache.ErrNil {
 		//no need no new message
 		return
 	}
@@ -76,72 +155,115 @@ func (s service) getUndeliveredMsg(ss *SsModel) {
 	}
 
 	//fetch data from database where consume flg is not mark
-	entities, err := s.messageRepo.FindNewMsgByReceiverId(ss.Username)
+	entities, err := s.messageRepo.FindNewMsgByReceiverId(ss.ctx, ss.Username)
 	if err != nil {
 		zap.S().Errorf("s.messageRepo.FindNewMsgByReceiverId: %v", err)
 		return
 	}
 
-	//send all message to client
-	var ok []int64
+	//flag is cleared only after every row reached the socket, a row that is given up keeps it for the next connection
+	remaining := int64(len(entities))
+	if remaining == 0 {
+		s.clearUndelivered(ss, flag)
+		return
+	}
+
+	//send all message to client, replay waits for the writer so a backlog longer than the queue keeps its order
 	for _, entity := range entities {
 		tmp := model.ChatMessage{
+			Id:         entity.Id,         //for read receipt
+			RoomId:     entity.RoomId,     //room message stored for offline member
 			ReceiverId: entity.ReceiverId, //to whom?
 			SenderId:   entity.SenderId,   //from whom?
 			Msg:        entity.Message,    //message
 			SendDtm:    entity.SendDtm,    //when?
 		}
-		j, err := json.Marshal(&tmp)
+		e, err := model.NewEnvelope(model.KindChat, "", &tmp)
 		if err != nil {
-			zap.S().Error("json.Marshal: %v", err)
+			zap.S().Errorf("model.NewEnvelope: %v", err)
 			break
 		}
-
-		//send message to client
-		err = wsutil.WriteServerMessage(ss.Conn, ws.OpText, j)
+		j, err := json.Marshal(&e)
 		if err != nil {
-			zap.S().Error("wsutil.WriteServerMessage: %v", err)
+			zap.S().Errorf("json.Marshal: %v", err)
 			break
 		}
-		ok = append(ok, entity.Id)
-	}
 
-	if len(ok) > 0 {
-		//update undelivered message to read when send to client successfully
-		err = s.messageRepo.UpdateIsRead(ok)
+		//update undelivered message to delivered once written to client, read state comes from client read frame
+		id := entity.Id
+		err = ss.enqueueWait(outbound{
+			data: j,
+			written: func() {
+				err := s.messageRepo.MarkDelivered(ss.ctx, []int64{id}, time.Now())
+				if err != nil {
+					zap.S().Errorf("s.messageRepo.MarkDelivered: %v", err)
+					return
+				}
+				if atomic.AddInt64(&remaining, -1) == 0 {
+					s.clearUndelivered(ss, flag)
+				}
+			},
+			spill: func() {
+				s.raiseUndelivered(ss)
+			},
+		})
 		if err != nil {
-			zap.S().Errorf("s.messageRepo.UpdateIsRead: %v", err)
-			return
+			zap.S().Errorf("ss.enqueueWait: %v", err)
+			break
 		}
 	}
+}
 
-	//if send success then mark consume flag to
-	err = s.cache.Del(ss.Username)
+// clearUndelivered removes the flag unless a sender raised it again since flag was read, the value is the raise time in nanosecond
+func (s service) clearUndelivered(ss *SsModel, flag string) {
+	key := fmt.Sprintf(delivery.RdbUndelivered, ss.Username)
+	v, err := s.cache.Get(ss.ctx, key)
+	if err != nil || v != flag {
+		return
+	}
+	err = s.cache.Del(ss.ctx, key)
 	if err != nil {
-		zap.S().Error("s.cache.Del: %v", err)
+		zap.S().Errorf("s.cache.Del: %v", err)
+	}
+}
+
+// raiseUndelivered runs for a frame given up, it may be after the connection ended so ss.ctx is not used
+func (s service) raiseUndelivered(ss *SsModel) {
+	err := s.cache.Set(context.Background(), fmt.Sprintf(delivery.RdbUndelivered, ss.Username), time.Now().Format(time.RFC3339Nano), 24*time.Hour)
+	if err != nil {
+		zap.S().Errorf("s.cache.Set: %v", err)
 	}
 }
 
 func (s service) readClientMsg(ss *SsModel) {
 	var endChan = make(chan bool)
 	defer close(endChan)
+
+	//keep presence alive while client answers ping
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.heartbeat(ss, stop)
+	defer s.endAllTyping(ss)
+
 	go func() {
 		for {
-			data, _, err := wsutil.ReadClientData(ss.Conn)
+			data, err := ss.readClientData()
 			if err != nil {
-				switch err.(type) {
-				case wsutil.ClosedError:
-					//remove online status
-					s.setStatus(ss, statusOffline)
-				default:
-					zap.S().Error("cannot read message from client: %v", err)
+				if _, ok := err.(wsutil.ClosedError); !ok {
+					zap.S().Errorf("cannot read message from client: %v", err)
 				}
+				//remove this device from online status
+				s.setStatus(ss, model.StatusOffline)
 				endChan <- true
 				_ = ss.Conn.Close()
 				break
 			}
 
-			go s.forwardMsgToReceiver(data)
+			done := s.registry.track()
+			go func() {
+				defer done()
+				s.handleClientMsg(ss, data)
+			}()
 		}
 	}()
 
@@ -149,94 +271,209 @@ func (s service) readClientMsg(ss *SsModel) {
 	s.subscribeMsg(ss, endChan)
 }
 
-func (s service) forwardMsgToReceiver(data []byte) {
-	//check if target user is now online, if yes publish message into redis pub/sub and then insert the msg into db with is_read is one (read)
-	//make sure that message delivered to target otherwise system should insert data into database instead
+func (s service) handleClientMsg(ss *SsModel, data []byte) {
+	e, err := s.dispatcher.dispatch(ss, data)
+	if err == nil {
+		return
+	}
+
+	//report the failure back to the sender, unexpected error detail is kept in log only
+	if errors.Is(err, delivery.ErrInFlight) {
+		err = &FrameError{Code: errCodeInFlight, Message: "message is still being sent, retry later"}
+	}
+	fe, ok := err.(*FrameError)
+	if !ok {
+		zap.S().Errorf("handle %s frame: %v", e.Type, err)
+		fe = &FrameError{Code: errCodeInternal, Message: "cannot process message"}
+	}
+	s.writeError(ss, e.Id, fe)
+}
+
+func (s service) pong(ss *SsModel, e model.Envelope) error {
+	pong, err := model.NewEnvelope(model.KindPong, e.Id, nil)
+	if err != nil {
+		return err
+	}
+	return ss.send(pong)
+}
+
+func (s service) forwardMsgToReceiver(ss *SsModel, e model.Envelope) error {
 	var reqMsg model.ChatMessage
-	err := json.Unmarshal(data, &reqMsg)
+	err := json.Unmarshal(e.Payload, &reqMsg)
 	if err != nil {
-		zap.S().Errorf("invalid request json format: %v", err)
-		return
+		return &FrameError{Code: errCodeInvalidMsg, Message: "invalid chat payload"}
+	}
+	if reqMsg.ReceiverId == "" && reqMsg.RoomId == 0 {
+		return &FrameError{Code: errCodeInvalidMsg, Message: "receiverId or roomId is required"}
+	}
+	if len(e.Id) > maxClientMsgId {
+		return &FrameError{Code: errCodeInvalidMsg, Message: fmt.Sprintf("id must not be longer than %d characters", maxClientMsgId)}
 	}
 
-	//check if target user online
-	var r int64
-	_, err = s.cache.Get(fmt.Sprintf(rdbOnline, reqMsg.ReceiverId))
-	if err == nil {
-		//target user is not online then publish message into channel
-		to := fmt.Sprintf(rdbPublish, reqMsg.ReceiverId)
-		r, err = s.cache.Pub(to, string(data)).Result()
+	//sender is always the authenticated user, reject client trying to speak for someone else
+	if reqMsg.SenderId != "" && reqMsg.SenderId != ss.Username {
+		zap.S().Warnf("%s tried to send message as %s", ss.Username, reqMsg.SenderId)
+		return &FrameError{Code: errCodeSenderMismatch, Message: "senderId does not match authenticated user"}
+	}
+	reqMsg.SenderId = ss.Username
+
+	//direct message
+	if reqMsg.RoomId == 0 {
+		result, err := s.delivery.Send(ss.ctx, reqMsg, e.Id)
 		if err != nil {
-			zap.S().Error("s.cache.Pub: %v", err)
-			goto offline
-		}
-		if r == 0 {
-			zap.S().Infof("not found %s then insert chat-message into database", to)
-			goto offline
+			return err
 		}
-		return
+		return s.ack(ss, e.Id, result)
 	}
 
-	//no cache found
-	if err == redis.Nil {
-		zap.S().Infof("%s is not online then insert chat-message into database", reqMsg.ReceiverId)
-		goto offline
+	//room message goes to every member, only member can post
+	members, err := s.roomRepo.FindMembers(ss.ctx, reqMsg.RoomId)
+	if err != nil {
+		return err
+	}
+	var receivers []string
+	isMember := false
+	for _, member := range members {
+		isMember = isMember || member.UserId == ss.Username
+		receivers = append(receivers, member.UserId)
 	}
+	if !isMember {
+		return &FrameError{Code: errCodeForbidden, Message: "not a member of the room"}
+	}
+	result, err := s.delivery.Fanout(ss.ctx, reqMsg, e.Id, receivers)
+	if err != nil {
+		return err
+	}
+	return s.ack(ss, e.Id, result)
+}
 
-	//err while get cache
+// ack tells the sender which id the message got and whether it reached the receiver or waits in storage
+func (s service) ack(ss *SsModel, clientMsgId string, result delivery.Result) error {
+	e, err := model.NewEnvelope(model.KindAck, clientMsgId, &model.AckPayload{
+		ClientMsgId: clientMsgId,
+		MsgId:       result.Id,
+		ServerDtm:   result.ServerDtm,
+		State:       result.State,
+	})
 	if err != nil {
-		zap.S().Error("error while get user status then insert chat-message into database")
-		goto offline
+		return err
 	}
+	return ss.send(e)
+}
 
-offline:
-	s.saveMsg(reqMsg, time.Now(), false)
+type SsModel struct {
+	Conn      net.Conn
+	Username  string `json:"username"`
+	SessionId string `json:"sessionId"`
+	DeviceId  string `json:"deviceId"`
+	ctx       context.Context
+	cancel    context.CancelFunc
+	out       chan outbound
+	overflow  string
+	//stopped is closed once writer loop ends, qMu lets it wait enqueue in progress before draining out
+	stopped chan struct{}
+	qMu     sync.RWMutex
+	wMu     sync.Mutex
+	//writeTimeout bounds every write under wMu
+	writeTimeout time.Duration
+	active       int64
+	offline      int32
+	tMu          sync.Mutex
+	typing       map[string]*typingState
+	//typingWindow and typingRelays count typing relays of the current second
+	typingWindow time.Time
+	typingRelays int
+}
 
-	//set
-	err = s.cache.Set(fmt.Sprintf(rdbUndelivered, reqMsg.ReceiverId), time.Now().Format(time.RFC3339), 24*time.Hour)
+// send queues frame for the writer goroutine so subscriber loop and client handlers never race on the connection
+func (ss *SsModel) send(e model.Envelope) error {
+	j, err := json.Marshal(&e)
 	if err != nil {
-		zap.S().Errorf("s.cache.Set: %v", err)
+		return err
 	}
+	return ss.enqueue(outbound{data: j})
 }
 
-type SsModel struct {
-	Conn     net.Conn
-	Username string `json:"username"`
+func (s service) authenticate(r *http.Request) (string, error) {
+	username, err := s.authenticator.Authenticate(r)
+	if err != nil {
+		return "", err
+	}
+
+	//the url param is kept for compatibility, it must match the verified identity
+	if p := chi.URLParam(r, "username"); p != "" && p != username {
+		return "", fmt.Errorf("%w: %s cannot connect as %s", auth.ErrForbidden, username, p)
+	}
+	return username, nil
 }
 
-func initConnection(w http.ResponseWriter, r *http.Request) (*SsModel, error) {
-	username := chi.URLParam(r, "username")
-	conn, _, _, err := ws.UpgradeHTTP(r, w)
+func initConnection(w http.ResponseWriter, r *http.Request, username string, queueSize int, overflow string, writeTimeout time.Duration) (*SsModel, error) {
+	//select access_token sub protocol so browser clients passing the token that way accept the handshake
+	upgrader := ws.HTTPUpgrader{
+		Protocol: func(p string) bool {
+			return p == auth.ProtocolAccessToken
+		},
+	}
+	conn, _, _, err := upgrader.Upgrade(r, w)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SsModel{
-		Conn:     conn,
-		Username: username,
-	}, nil
+	//every cache and database call of this connection is cancelled once the connection ends
+	ctx, cancel := context.WithCancel(r.Context())
+	ss := &SsModel{
+		ctx:          ctx,
+		cancel:       cancel,
+		Conn:         conn,
+		Username:     username,
+		SessionId:    newSessionId(),
+		DeviceId:     r.URL.Query().Get("device"),
+		out:          make(chan outbound, queueSize),
+		overflow:     overflow,
+		stopped:      make(chan struct{}),
+		writeTimeout: writeTimeout,
+		typing:       make(map[string]*typingState),
+	}
+	//device id lets stream backend replay pending message of the same device, connection without it uses the default group
+	ss.touch()
+	return ss, nil
 }
 
-func (s service) setStatus(ss *SsModel, status string) {
-	//check if user disconnect
-	msg := fmt.Sprintf(rdbOnline, ss.Username)
+// newSessionId identifies one connection so each device of the same user is tracked separately
+func newSessionId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-	//turned status to online
-	if status == statusOnline {
-		zap.S().Infof("%s is now online", ss.Username)
-		err := s.cache.Set(msg, msg, 24*time.Hour)
+func (s service) setStatus(ss *SsModel, status string) {
+	//turned status to online, watchers are told only when the first device connects
+	if status == model.StatusOnline {
+		zap.S().Infof("%s is now online on session %s", ss.Username, ss.SessionId)
+		first, err := s.presence.Connect(ss.ctx, ss.Username, ss.SessionId)
 		if err != nil {
-			zap.S().Error("s.cache.Set: %v", err)
+			zap.S().Errorf("s.presence.Connect: %v", err)
+			return
+		}
+		if first {
+			s.broadcastPresence(ss.ctx, model.Presence{UserId: ss.Username, Status: model.StatusOnline})
 		}
 		return
 	}
 
-	//turned status to offline
-	if status == statusOffline {
-		zap.S().Infof("%s is now offline", ss.Username)
-		err := s.cache.Del(msg)
+	//turned status to offline, other devices keep the user online. shutdown and reader loop may both end the session
+	if status == model.StatusOffline {
+		if !atomic.CompareAndSwapInt32(&ss.offline, 0, 1) {
+			return
+		}
+		last, err := s.presence.Disconnect(ss.ctx, ss.Username, ss.SessionId)
 		if err != nil {
-			zap.S().Error("s.cache.Del: %v", err)
+			zap.S().Errorf("s.presence.Disconnect: %v", err)
+		}
+		if last {
+			zap.S().Infof("%s is now offline", ss.Username)
+			n := time.Now()
+			s.broadcastPresence(ss.ctx, model.Presence{UserId: ss.Username, Status: model.StatusOffline, LastSeen: &n})
 		}
 		return
 	}
@@ -245,70 +482,106 @@ func (s service) setStatus(ss *SsModel, status string) {
 }
 
 func (s service) subscribeMsg(ss *SsModel, endChan chan bool) {
+	sub, err := s.delivery.Subscribe(ss.ctx, ss.Username, ss.DeviceId)
+	if err != nil {
+		//without subscription the client cannot receive anything, drop the connection and wait reader loop to end
+		zap.S().Errorf("s.delivery.Subscribe: %v", err)
+		_ = ss.Conn.Close()
+		<-endChan
+		return
+	}
+	defer sub.Close()
+
 	run := true
-	ps := s.cache.Sub(fmt.Sprintf(rdbPublish, ss.Username))
 	for run {
 		select {
 		case <-endChan:
 			zap.S().Infof("%s stop subscribe message", ss.Username)
 			run = false
 		default:
-			msg, err := ps.ReceiveTimeout(context.Background(), time.Second)
+			msg, err := sub.Receive(time.Second)
 			if err != nil {
-				switch err.(type) {
-				case *net.OpError:
-					//timeout here
-					continue
-				default:
-					zap.S().Errorf("s.cache.Sub: %v", err)
-					continue
-				}
+				zap.S().Errorf("sub.Receive: %v", err)
+				continue
+			}
+			if msg == nil {
+				continue
 			}
-			s.writeServerMessage(ss, msg)
+			s.writeServerMessage(ss, sub, msg)
 		}
 	}
 }
 
-func (s service) writeServerMessage(ss *SsModel, msg interface{}) {
-	switch msg := msg.(type) {
-	case *redis.Message:
-		//unmarshal message and
-		var m model.ChatMessage
-		var n = time.Now()
-		err := json.Unmarshal([]byte(msg.Payload), &m)
+func (s service) writeServerMessage(ss *SsModel, sub delivery.Subscription, msg *delivery.Msg) {
+	//message is already persisted by sender side, just relay it to client
+	frame, id, err := s.resolve(ss, msg)
+	if err != nil {
+		//stream backend would replay the same entry forever, give it up to the undelivered row which reconnect fetches
+		zap.S().Errorf("s.delivery.Resolve: %v", err)
+		err = s.delivery.Spill(ss.ctx, ss.Username, msg.Payload)
 		if err != nil {
-			zap.S().Errorf("json.Unmarshal: %v", err)
+			zap.S().Errorf("s.delivery.Spill: %v", err)
 			return
 		}
-		m.SendDtm = &n
-
-		//return message back if success
-		j, _ := json.Marshal(&m)
-		err = wsutil.WriteServerMessage(ss.Conn, ws.OpText, j)
+		err = sub.Ack(msg)
 		if err != nil {
-			_ = ss.Conn.Close()
-			return
+			zap.S().Errorf("sub.Ack: %v", err)
 		}
-		s.saveMsg(m, n, true)
-	default:
-		//do nothing
+		return
 	}
-}
+	err = ss.enqueue(outbound{
+		data: frame,
+		written: func() {
+			//persist first path stores message as undelivered, flip it once the frame reached the socket
+			if id != 0 {
+				err := s.delivery.MarkDelivered(ss.ctx, id)
+				if err != nil {
+					zap.S().Errorf("s.delivery.MarkDelivered: %v", err)
+				}
+			}
 
-func (s service) saveMsg(m model.ChatMessage, n time.Time, isRead bool) error {
-	e := repository.MessageEntity{
-		ReceiverId: m.ReceiverId,
-		SenderId:   m.SenderId,
-		Message:    m.Msg,
-		IsRead:     isRead,
-		SendDtm:    &n,
+			//ack only after the frame reached the socket, stream backend replays unacked message on reconnect
+			err := sub.Ack(msg)
+			if err != nil {
+				zap.S().Errorf("sub.Ack: %v", err)
+			}
+		},
+		spill: func() {
+			//writer spills what is left after the connection ended, ss.ctx is cancelled by then
+			err := s.delivery.Spill(context.Background(), ss.Username, msg.Payload)
+			if err != nil {
+				zap.S().Errorf("s.delivery.Spill: %v", err)
+			}
+		},
+	})
+	if err != nil {
+		zap.S().Errorf("ss.enqueue: %v", err)
 	}
-	if isRead {
-		e.ReadDtm = &n
+}
+
+// resolve retries transient failure like a database hiccup a few times before the message is given up
+func (s service) resolve(ss *SsModel, msg *delivery.Msg) ([]byte, int64, error) {
+	var err error
+	for i := 0; i < resolveAttempts; i++ {
+		var frame []byte
+		var id int64
+		frame, id, err = s.delivery.Resolve(ss.ctx, ss.Username, msg.Payload)
+		if err == nil || i == resolveAttempts-1 {
+			return frame, id, err
+		}
+		select {
+		case <-ss.ctx.Done():
+			return nil, 0, err
+		case <-time.After(resolveBackoff * time.Duration(i+1)):
+		}
 	}
-	err := s.messageRepo.Create(e)
+	return nil, 0, err
+}
+
+func (s service) writeError(ss *SsModel, id string, fe *FrameError) {
+	e, _ := model.NewEnvelope(model.KindError, id, &model.ErrorPayload{Code: fe.Code, Message: fe.Message})
+	err := ss.send(e)
 	if err != nil {
-		zap.S().Errorf("s.messageRepo.Create: %v", err)
+		zap.S().Errorf("ss.send: %v", err)
 	}
-	return err
 }
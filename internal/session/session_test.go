@@ -1,44 +1,247 @@
 package session
 
 import (
+	"chat-session/internal/delivery"
 	"chat-session/internal/model"
 	"chat-session/internal/repository"
-	"chat-session/internal/tests/mock"
+	"chat-session/internal/tests/mock_cache"
+	"chat-session/internal/tests/mock_delivery"
+	"chat-session/internal/tests/mock_repository"
+	"context"
+	"encoding/json"
 	"errors"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
 	"testing"
 	"time"
 )
 
-func Test_saveMsg(t *testing.T) {
-	n := time.Now()
+func Test_getUndeliveredMsg(t *testing.T) {
+	const flag = "2022-01-01T00:00:00.000000001Z"
 	tt := []struct {
-		name            string
-		m               model.ChatMessage
-		chatMessageRepo repository.Message
-		isRead          bool
-		expectedE       error
+		name         string
+		read         int
+		currentFlag  string
+		expectedRead []int64
+		expectedDel  bool
+		expectedRise bool
 	}{
 		{
-			name:            "should return nil when create chat message successfully",
-			m:               model.ChatMessage{},
-			chatMessageRepo: mock.ChatMessageRepo(t, "OK", n),
-			isRead:          false,
-			expectedE:       nil,
+			name:         "should write backlog larger than queue in order and remove flag",
+			read:         3,
+			currentFlag:  flag,
+			expectedRead: []int64{1, 2, 3},
+			expectedDel:  true,
 		},
 		{
-			name:            "should return error when err while create chat message",
-			m:               model.ChatMessage{},
-			chatMessageRepo: mock.ChatMessageRepo(t, "!OK", n),
-			isRead:          false,
-			expectedE:       errors.New("mock err"),
+			name:         "should keep flag when client goes away during replay",
+			read:         1,
+			currentFlag:  flag,
+			expectedRead: []int64{1},
+			expectedRise: true,
+		},
+		{
+			name:         "should keep flag when sender raised it again meanwhile",
+			read:         3,
+			currentFlag:  "2022-01-01T00:00:01Z",
+			expectedRead: []int64{1, 2, 3},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			c := mock_cache.NewMockCache(ctrl)
+			repo := mock_repository.NewMockMessage(ctrl)
+			gomock.InOrder(
+				c.EXPECT().Get(gomock.Any(), "uefa-undelivered").Return(flag, nil),
+				c.EXPECT().Get(gomock.Any(), "uefa-undelivered").Return(tc.currentFlag, nil).MaxTimes(1),
+			)
+			repo.EXPECT().FindNewMsgByReceiverId(gomock.Any(), "uefa").Return([]repository.MessageEntity{{Id: 1}, {Id: 2}, {Id: 3}}, nil)
+			repo.EXPECT().MarkDelivered(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			deleted := false
+			c.EXPECT().Del(gomock.Any(), "uefa-undelivered").DoAndReturn(func(context.Context, string) error {
+				deleted = true
+				return nil
+			}).MaxTimes(1)
+			if tc.expectedRise {
+				c.EXPECT().Set(gomock.Any(), "uefa-undelivered", gomock.Any(), gomock.Any()).Return(nil).MinTimes(1)
+			}
+
+			server, client := net.Pipe()
+			defer server.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			ss := &SsModel{ctx: ctx, cancel: cancel, Conn: server, Username: "uefa", out: make(chan outbound, 1), overflow: OverflowSpill, stopped: make(chan struct{})}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				ss.writeLoop()
+			}()
+
+			//client reads some frames then goes away, replay must wait for it instead of overflowing the queue
+			reader := make(chan []int64)
+			go func() {
+				defer client.Close()
+				var read []int64
+				for i := 0; i < tc.read; i++ {
+					data, err := wsutil.ReadServerText(client)
+					if err != nil {
+						break
+					}
+					var e model.Envelope
+					var m model.ChatMessage
+					_ = json.Unmarshal(data, &e)
+					_ = json.Unmarshal(e.Payload, &m)
+					read = append(read, m.Id)
+				}
+				reader <- read
+			}()
+
+			s := service{cache: c, messageRepo: repo}
+			s.getUndeliveredMsg(ss)
+			read := <-reader
+			cancel()
+			<-done
+			assert.Equal(t, tc.expectedRead, read)
+			assert.Equal(t, tc.expectedDel, deleted)
+		})
+	}
+}
+
+func Test_getUndeliveredMsgRoom(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	c := mock_cache.NewMockCache(ctrl)
+	repo := mock_repository.NewMockMessage(ctrl)
+	c.EXPECT().Get(gomock.Any(), "uefa-undelivered").Return("flag", nil).AnyTimes()
+	c.EXPECT().Del(gomock.Any(), "uefa-undelivered").Return(nil)
+	repo.EXPECT().FindNewMsgByReceiverId(gomock.Any(), "uefa").Return([]repository.MessageEntity{
+		{Id: 1, ReceiverId: "uefa", SenderId: "fifa", Message: "direct"},
+		{Id: 2, RoomId: 5, ReceiverId: "uefa", SenderId: "fifa", Message: "room"},
+	}, nil)
+	repo.EXPECT().MarkDelivered(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	ss := &SsModel{ctx: context.Background(), Username: "uefa", out: make(chan outbound, 2), overflow: OverflowSpill}
+	s := service{cache: c, messageRepo: repo}
+	s.getUndeliveredMsg(ss)
+
+	//room message stored for an offline member must reach the client as a room message
+	var roomIds []int64
+	for len(ss.out) > 0 {
+		o := <-ss.out
+		var e model.Envelope
+		assert.Nil(t, json.Unmarshal(o.data, &e))
+		var m model.ChatMessage
+		assert.Nil(t, json.Unmarshal(e.Payload, &m))
+		roomIds = append(roomIds, m.RoomId)
+		o.written()
+	}
+	assert.Equal(t, []int64{0, 5}, roomIds)
+}
+
+// ackRecorder is a subscription which only records acked ids
+type ackRecorder struct {
+	acked []string
+}
+
+func (r *ackRecorder) Receive(time.Duration) (*delivery.Msg, error) {
+	return nil, nil
+}
+
+func (r *ackRecorder) Ack(m *delivery.Msg) error {
+	r.acked = append(r.acked, m.Id)
+	return nil
+}
+
+func (r *ackRecorder) Close() error {
+	return nil
+}
+
+func Test_writeServerMessage(t *testing.T) {
+	tt := []struct {
+		name          string
+		resolveErrs   int
+		spillErr      error
+		expectedQueue int
+		expectedSpill bool
+		expectedAcked []string
+	}{
+		{
+			name:          "should write frame and ack after write when resolve recovers",
+			resolveErrs:   resolveAttempts - 1,
+			expectedQueue: 1,
+			expectedAcked: []string{"1-0"},
+		},
+		{
+			name:          "should spill and ack when resolve keeps failing",
+			resolveErrs:   resolveAttempts,
+			expectedSpill: true,
+			expectedAcked: []string{"1-0"},
+		},
+		{
+			name:          "should keep message unacked when spill fails",
+			resolveErrs:   resolveAttempts,
+			spillErr:      errors.New("mock err"),
+			expectedSpill: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := mock_delivery.NewMockService(gomock.NewController(t))
+			failed := d.EXPECT().Resolve(gomock.Any(), "uefa", "p").Return(nil, int64(0), errors.New("mock err")).Times(tc.resolveErrs)
+			if tc.resolveErrs < resolveAttempts {
+				d.EXPECT().Resolve(gomock.Any(), "uefa", "p").Return([]byte("frame"), int64(0), nil).After(failed)
+			}
+			if tc.expectedSpill {
+				d.EXPECT().Spill(gomock.Any(), "uefa", "p").Return(tc.spillErr)
+			}
+
+			ss := &SsModel{ctx: context.Background(), Username: "uefa", out: make(chan outbound, 1)}
+			sub := &ackRecorder{}
+			s := service{delivery: d}
+			s.writeServerMessage(ss, sub, &delivery.Msg{Id: "1-0", Payload: "p"})
+
+			assert.Len(t, ss.out, tc.expectedQueue)
+			for len(ss.out) > 0 {
+				(<-ss.out).written()
+			}
+			assert.Equal(t, tc.expectedAcked, sub.acked)
+		})
+	}
+}
+
+func Test_forwardMsgToReceiver(t *testing.T) {
+	tt := []struct {
+		name        string
+		id          string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:        "should reject message without receiver",
+			id:          "c-1",
+			payload:     `{"msg":"hi"}`,
+			expectedErr: &FrameError{Code: errCodeInvalidMsg, Message: "receiverId or roomId is required"},
+		},
+		{
+			name:        "should reject client message id longer than the column",
+			id:          strings.Repeat("a", maxClientMsgId+1),
+			payload:     `{"receiverId":"afc","msg":"hi"}`,
+			expectedErr: &FrameError{Code: errCodeInvalidMsg, Message: "id must not be longer than 64 characters"},
+		},
+		{
+			name:        "should reject sender speaking for someone else",
+			id:          strings.Repeat("a", maxClientMsgId),
+			payload:     `{"receiverId":"afc","senderId":"fifa","msg":"hi"}`,
+			expectedErr: &FrameError{Code: errCodeSenderMismatch, Message: "senderId does not match authenticated user"},
 		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			s := service{messageRepo: tc.chatMessageRepo}
-			e := s.saveMsg(tc.m, n, tc.isRead)
-			assert.Equal(t, tc.expectedE, e)
+			ss := &SsModel{ctx: context.Background(), Username: "uefa"}
+			err := service{}.forwardMsgToReceiver(ss, model.Envelope{Id: tc.id, Payload: json.RawMessage(tc.payload)})
+			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
 }
@@ -0,0 +1,183 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// typingState is kept per connection and target, it never touches database
+type typingState struct {
+	target    model.TypingPayload
+	lastRelay time.Time
+	expiry    *time.Timer
+}
+
+func (s service) startTyping(ss *SsModel, e model.Envelope) error {
+	target, err := s.typingTarget(ss, e)
+	if err != nil {
+		return err
+	}
+	key := typingKey(target)
+
+	ss.tMu.Lock()
+	st, ok := ss.typing[key]
+	if !ok {
+		//every tracked target holds a timer, cap them so one connection cannot grow the map without bound
+		if s.typingMaxTargets > 0 && len(ss.typing) >= s.typingMaxTargets {
+			ss.tMu.Unlock()
+			return &FrameError{Code: errCodeRateLimited, Message: "too many typing targets"}
+		}
+		st = &typingState{target: target}
+		st.expiry = time.AfterFunc(s.typingExpiry, func() {
+			//client never sent stop, release the indicator on its behalf
+			s.endTyping(ss, key)
+		})
+		ss.typing[key] = st
+	} else {
+		st.expiry.Reset(s.typingExpiry)
+	}
+
+	//throttle repeated start, receiver keeps showing the indicator until stop or expiry
+	if time.Since(st.lastRelay) < s.typingThrottle {
+		ss.tMu.Unlock()
+		return nil
+	}
+	if !ss.allowTyping(s.typingRateLimit) {
+		ss.tMu.Unlock()
+		return &FrameError{Code: errCodeRateLimited, Message: "too many typing frames"}
+	}
+	st.lastRelay = time.Now()
+	ss.tMu.Unlock()
+
+	//lookup and publish run outside tMu so a slow database does not block other targets and the expiry timers
+	err = s.relayTyping(ss, target, model.TypingStart)
+	if err != nil {
+		ss.tMu.Lock()
+		if ss.typing[key] == st {
+			st.expiry.Stop()
+			delete(ss.typing, key)
+		}
+		ss.tMu.Unlock()
+	}
+	return err
+}
+
+// allowTyping counts one relay against the per second limit of the connection, caller holds tMu
+func (ss *SsModel) allowTyping(limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+	n := time.Now()
+	if n.Sub(ss.typingWindow) >= time.Second {
+		ss.typingWindow = n
+		ss.typingRelays = 0
+	}
+	if ss.typingRelays >= limit {
+		return false
+	}
+	ss.typingRelays++
+	return true
+}
+
+func (s service) stopTyping(ss *SsModel, e model.Envelope) error {
+	target, err := s.typingTarget(ss, e)
+	if err != nil {
+		return err
+	}
+	s.endTyping(ss, typingKey(target))
+	return nil
+}
+
+// endTyping relays stop only when start was relayed before, so stop cannot be used to flood the channel
+func (s service) endTyping(ss *SsModel, key string) {
+	ss.tMu.Lock()
+	st, ok := ss.typing[key]
+	if ok {
+		st.expiry.Stop()
+		delete(ss.typing, key)
+	}
+	ss.tMu.Unlock()
+	if !ok {
+		return
+	}
+
+	err := s.relayTyping(ss, st.target, model.TypingStop)
+	if err != nil {
+		zap.S().Errorf("s.relayTyping: %v", err)
+	}
+}
+
+// endAllTyping is called when connection ends so peers do not keep a stale indicator
+func (s service) endAllTyping(ss *SsModel) {
+	ss.tMu.Lock()
+	keys := make([]string, 0, len(ss.typing))
+	for key := range ss.typing {
+		keys = append(keys, key)
+	}
+	ss.tMu.Unlock()
+	for _, key := range keys {
+		s.endTyping(ss, key)
+	}
+}
+
+func (s service) typingTarget(ss *SsModel, e model.Envelope) (model.TypingPayload, error) {
+	var target model.TypingPayload
+	err := json.Unmarshal(e.Payload, &target)
+	if err != nil {
+		return target, &FrameError{Code: errCodeInvalidMsg, Message: "invalid typing payload"}
+	}
+	if target.RoomId != 0 {
+		return model.TypingPayload{RoomId: target.RoomId}, nil
+	}
+	if target.ReceiverId == "" || target.ReceiverId == ss.Username {
+		return target, &FrameError{Code: errCodeInvalidMsg, Message: "receiverId or roomId is required"}
+	}
+	return model.TypingPayload{ReceiverId: target.ReceiverId}, nil
+}
+
+func (s service) relayTyping(ss *SsModel, target model.TypingPayload, state string) error {
+	target.UserId = ss.Username
+	target.State = state
+	e, err := model.NewEnvelope(model.KindTyping, "", &target)
+	if err != nil {
+		return err
+	}
+
+	receivers := []string{target.ReceiverId}
+	if target.RoomId != 0 {
+		members, err := s.roomRepo.FindMembers(ss.ctx, target.RoomId)
+		if err != nil {
+			return err
+		}
+		receivers = receivers[:0]
+		isMember := false
+		for _, member := range members {
+			if member.UserId == ss.Username {
+				isMember = true
+				continue
+			}
+			receivers = append(receivers, member.UserId)
+		}
+		if !isMember {
+			return &FrameError{Code: errCodeForbidden, Message: "not a member of the room"}
+		}
+	}
+
+	for _, receiverId := range receivers {
+		_, err = s.delivery.Publish(ss.ctx, receiverId, e)
+		if err != nil {
+			zap.S().Errorf("s.delivery.Publish: %v", err)
+		}
+	}
+	return nil
+}
+
+func typingKey(target model.TypingPayload) string {
+	if target.RoomId != 0 {
+		return fmt.Sprintf("room:%d", target.RoomId)
+	}
+	return "user:" + target.ReceiverId
+}
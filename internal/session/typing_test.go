@@ -0,0 +1,111 @@
+package session
+
+import (
+	"chat-session/internal/model"
+	"chat-session/internal/tests/mock_delivery"
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// typingRecorder collects relayed typing states per receiver
+type typingRecorder struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (r *typingRecorder) publish(_ context.Context, userId string, e model.Envelope) (int64, error) {
+	var p model.TypingPayload
+	_ = json.Unmarshal(e.Payload, &p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, userId+":"+p.State)
+	return 1, nil
+}
+
+func (r *typingRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.states...)
+}
+
+func typingFrame(receiverId string) model.Envelope {
+	return model.Envelope{Type: model.KindTypingStart, Payload: []byte(`{"receiverId":"` + receiverId + `"}`)}
+}
+
+func Test_startTyping(t *testing.T) {
+	tt := []struct {
+		name           string
+		rateLimit      int
+		maxTargets     int
+		receivers      []string
+		expectedCode   string
+		expectedStates []string
+	}{
+		{
+			name:           "should relay repeated start to the same target once within throttle",
+			receivers:      []string{"uefa", "uefa", "uefa"},
+			expectedStates: []string{"uefa:start"},
+		},
+		{
+			name:           "should reject start when session exceeds rate limit",
+			rateLimit:      2,
+			receivers:      []string{"uefa", "afc", "caf"},
+			expectedCode:   errCodeRateLimited,
+			expectedStates: []string{"uefa:start", "afc:start"},
+		},
+		{
+			name:           "should reject new target when session tracks too many targets",
+			maxTargets:     1,
+			receivers:      []string{"uefa", "afc"},
+			expectedCode:   errCodeRateLimited,
+			expectedStates: []string{"uefa:start"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &typingRecorder{}
+			d := mock_delivery.NewMockService(gomock.NewController(t))
+			d.EXPECT().Publish(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(r.publish).AnyTimes()
+			s := service{delivery: d, typingExpiry: time.Minute, typingThrottle: time.Minute, typingRateLimit: tc.rateLimit, typingMaxTargets: tc.maxTargets}
+			ss := &SsModel{ctx: context.Background(), Username: "fifa", typing: make(map[string]*typingState)}
+			defer s.endAllTyping(ss)
+
+			var err error
+			for _, receiverId := range tc.receivers {
+				err = s.startTyping(ss, typingFrame(receiverId))
+			}
+			if tc.expectedCode != "" {
+				fe, ok := err.(*FrameError)
+				assert.True(t, ok)
+				assert.Equal(t, tc.expectedCode, fe.Code)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.expectedStates, r.get())
+		})
+	}
+}
+
+func Test_typingExpiry(t *testing.T) {
+	r := &typingRecorder{}
+	d := mock_delivery.NewMockService(gomock.NewController(t))
+	d.EXPECT().Publish(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(r.publish).AnyTimes()
+	s := service{delivery: d, typingExpiry: 20 * time.Millisecond, typingThrottle: time.Minute}
+	ss := &SsModel{ctx: context.Background(), Username: "fifa", typing: make(map[string]*typingState)}
+
+	assert.Nil(t, s.startTyping(ss, typingFrame("uefa")))
+	//client never sends stop, server relays it once the indicator expires
+	assert.Eventually(t, func() bool {
+		return len(r.get()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"uefa:start", "uefa:stop"}, r.get())
+
+	ss.tMu.Lock()
+	defer ss.tMu.Unlock()
+	assert.Empty(t, ss.typing)
+}
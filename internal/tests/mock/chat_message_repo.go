@@ -14,16 +14,16 @@ func ChatMessageRepo(t *testing.T, tc string, n time.Time) *mock_repository.Mock
 	case "OK":
 		mockCtrl := gomock.NewController(t)
 		repo := mock_repository.NewMockMessage(mockCtrl)
-		repo.EXPECT().Create(repository.MessageEntity{SendDtm: &n}).Return(nil).AnyTimes()
-		repo.EXPECT().FindNewMsgByReceiverId("uefa").Return([]repository.MessageEntity{}, nil).AnyTimes()
-		repo.EXPECT().UpdateIsRead([]int64{1}).Return(nil).AnyTimes()
+		repo.EXPECT().Create(gomock.Any(), repository.MessageEntity{SendDtm: &n}).Return(int64(1), nil).AnyTimes()
+		repo.EXPECT().FindNewMsgByReceiverId(gomock.Any(), "uefa").Return([]repository.MessageEntity{}, nil).AnyTimes()
+		repo.EXPECT().MarkDelivered(gomock.Any(), []int64{1}, n).Return(nil).AnyTimes()
 		return repo
 	case "!OK":
 		mockCtrl := gomock.NewController(t)
 		repo := mock_repository.NewMockMessage(mockCtrl)
-		repo.EXPECT().Create(repository.MessageEntity{SendDtm: &n}).Return(errors.New("mock err")).AnyTimes()
-		repo.EXPECT().FindNewMsgByReceiverId("uefa").Return(nil, errors.New("mock err")).AnyTimes()
-		repo.EXPECT().UpdateIsRead([]int64{1}).Return(errors.New("mock err")).AnyTimes()
+		repo.EXPECT().Create(gomock.Any(), repository.MessageEntity{SendDtm: &n}).Return(int64(0), errors.New("mock err")).AnyTimes()
+		repo.EXPECT().FindNewMsgByReceiverId(gomock.Any(), "uefa").Return(nil, errors.New("mock err")).AnyTimes()
+		repo.EXPECT().MarkDelivered(gomock.Any(), []int64{1}, n).Return(errors.New("mock err")).AnyTimes()
 		return repo
 	}
 
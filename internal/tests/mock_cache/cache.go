@@ -0,0 +1,462 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./internal/cache/cache.go
+
+// Package mock_cache is a generated GoMock package.
+package mock_cache
+
+import (
+	cache "chat-session/internal/cache"
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSubscription is a mock of Subscription interface.
+type MockSubscription struct {
+	ctrl     *gomock.Controller
+	recorder *MockSubscriptionMockRecorder
+}
+
+// MockSubscriptionMockRecorder is the mock recorder for MockSubscription.
+type MockSubscriptionMockRecorder struct {
+	mock *MockSubscription
+}
+
+// NewMockSubscription creates a new mock instance.
+func NewMockSubscription(ctrl *gomock.Controller) *MockSubscription {
+	mock := &MockSubscription{ctrl: ctrl}
+	mock.recorder = &MockSubscriptionMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSubscription) EXPECT() *MockSubscriptionMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockSubscription) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockSubscriptionMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockSubscription)(nil).Close))
+}
+
+// Receive mocks base method.
+func (m *MockSubscription) Receive(ctx context.Context, timeout time.Duration) (*cache.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Receive", ctx, timeout)
+	ret0, _ := ret[0].(*cache.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Receive indicates an expected call of Receive.
+func (mr *MockSubscriptionMockRecorder) Receive(ctx, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Receive", reflect.TypeOf((*MockSubscription)(nil).Receive), ctx, timeout)
+}
+
+// MockCache is a mock of Cache interface.
+type MockCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheMockRecorder
+}
+
+// MockCacheMockRecorder is the mock recorder for MockCache.
+type MockCacheMockRecorder struct {
+	mock *MockCache
+}
+
+// NewMockCache creates a new mock instance.
+func NewMockCache(ctrl *gomock.Controller) *MockCache {
+	mock := &MockCache{ctrl: ctrl}
+	mock.recorder = &MockCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCache) EXPECT() *MockCacheMockRecorder {
+	return m.recorder
+}
+
+// Del mocks base method.
+func (m *MockCache) Del(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Del", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Del indicates an expected call of Del.
+func (mr *MockCacheMockRecorder) Del(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockCache)(nil).Del), ctx, key)
+}
+
+// Get mocks base method.
+func (m *MockCache) Get(ctx context.Context, key string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCacheMockRecorder) Get(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCache)(nil).Get), ctx, key)
+}
+
+// HGetAll mocks base method.
+func (m *MockCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HGetAll", ctx, key)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HGetAll indicates an expected call of HGetAll.
+func (mr *MockCacheMockRecorder) HGetAll(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HGetAll", reflect.TypeOf((*MockCache)(nil).HGetAll), ctx, key)
+}
+
+// HIncrBy mocks base method.
+func (m *MockCache) HIncrBy(ctx context.Context, key, field string, incr int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HIncrBy", ctx, key, field, incr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HIncrBy indicates an expected call of HIncrBy.
+func (mr *MockCacheMockRecorder) HIncrBy(ctx, key, field, incr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HIncrBy", reflect.TypeOf((*MockCache)(nil).HIncrBy), ctx, key, field, incr)
+}
+
+// HIncrByIfExists mocks base method.
+func (m *MockCache) HIncrByIfExists(ctx context.Context, key, guard, field string, incr int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HIncrByIfExists", ctx, key, guard, field, incr)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HIncrByIfExists indicates an expected call of HIncrByIfExists.
+func (mr *MockCacheMockRecorder) HIncrByIfExists(ctx, key, guard, field, incr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HIncrByIfExists", reflect.TypeOf((*MockCache)(nil).HIncrByIfExists), ctx, key, guard, field, incr)
+}
+
+// HSet mocks base method.
+func (m *MockCache) HSet(ctx context.Context, key string, values map[string]string, ttl ...time.Duration) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, values}
+	for _, a := range ttl {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HSet", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HSet indicates an expected call of HSet.
+func (mr *MockCacheMockRecorder) HSet(ctx, key, values interface{}, ttl ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, values}, ttl...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HSet", reflect.TypeOf((*MockCache)(nil).HSet), varargs...)
+}
+
+// HSetIfEqual mocks base method.
+func (m *MockCache) HSetIfEqual(ctx context.Context, key, field, expected string, values map[string]string, ttl ...time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, field, expected, values}
+	for _, a := range ttl {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HSetIfEqual", varargs...)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HSetIfEqual indicates an expected call of HSetIfEqual.
+func (mr *MockCacheMockRecorder) HSetIfEqual(ctx, key, field, expected, values interface{}, ttl ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, field, expected, values}, ttl...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HSetIfEqual", reflect.TypeOf((*MockCache)(nil).HSetIfEqual), varargs...)
+}
+
+// Pub mocks base method.
+func (m *MockCache) Pub(ctx context.Context, channel, msg string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pub", ctx, channel, msg)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Pub indicates an expected call of Pub.
+func (mr *MockCacheMockRecorder) Pub(ctx, channel, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pub", reflect.TypeOf((*MockCache)(nil).Pub), ctx, channel, msg)
+}
+
+// SAdd mocks base method.
+func (m *MockCache) SAdd(ctx context.Context, key, member string, ttl ...time.Duration) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, member}
+	for _, a := range ttl {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SAdd", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SAdd indicates an expected call of SAdd.
+func (mr *MockCacheMockRecorder) SAdd(ctx, key, member interface{}, ttl ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, member}, ttl...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SAdd", reflect.TypeOf((*MockCache)(nil).SAdd), varargs...)
+}
+
+// SMembers mocks base method.
+func (m *MockCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SMembers", ctx, key)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SMembers indicates an expected call of SMembers.
+func (mr *MockCacheMockRecorder) SMembers(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SMembers", reflect.TypeOf((*MockCache)(nil).SMembers), ctx, key)
+}
+
+// SRem mocks base method.
+func (m *MockCache) SRem(ctx context.Context, key, member string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SRem", ctx, key, member)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SRem indicates an expected call of SRem.
+func (mr *MockCacheMockRecorder) SRem(ctx, key, member interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SRem", reflect.TypeOf((*MockCache)(nil).SRem), ctx, key, member)
+}
+
+// Set mocks base method.
+func (m *MockCache) Set(ctx context.Context, key, val string, ttl ...time.Duration) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, val}
+	for _, a := range ttl {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Set", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockCacheMockRecorder) Set(ctx, key, val interface{}, ttl ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, val}, ttl...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCache)(nil).Set), varargs...)
+}
+
+// SetNX mocks base method.
+func (m *MockCache) SetNX(ctx context.Context, key, val string, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNX", ctx, key, val, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetNX indicates an expected call of SetNX.
+func (mr *MockCacheMockRecorder) SetNX(ctx, key, val, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNX", reflect.TypeOf((*MockCache)(nil).SetNX), ctx, key, val, ttl)
+}
+
+// Sub mocks base method.
+func (m *MockCache) Sub(ctx context.Context, channel string) (cache.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sub", ctx, channel)
+	ret0, _ := ret[0].(cache.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Sub indicates an expected call of Sub.
+func (mr *MockCacheMockRecorder) Sub(ctx, channel interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sub", reflect.TypeOf((*MockCache)(nil).Sub), ctx, channel)
+}
+
+// XAck mocks base method.
+func (m *MockCache) XAck(ctx context.Context, stream, group, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XAck", ctx, stream, group, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// XAck indicates an expected call of XAck.
+func (mr *MockCacheMockRecorder) XAck(ctx, stream, group, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XAck", reflect.TypeOf((*MockCache)(nil).XAck), ctx, stream, group, id)
+}
+
+// XAdd mocks base method.
+func (m *MockCache) XAdd(ctx context.Context, stream, payload string, maxLen int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XAdd", ctx, stream, payload, maxLen)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// XAdd indicates an expected call of XAdd.
+func (mr *MockCacheMockRecorder) XAdd(ctx, stream, payload, maxLen interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XAdd", reflect.TypeOf((*MockCache)(nil).XAdd), ctx, stream, payload, maxLen)
+}
+
+// XGroupCount mocks base method.
+func (m *MockCache) XGroupCount(ctx context.Context, stream string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XGroupCount", ctx, stream)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// XGroupCount indicates an expected call of XGroupCount.
+func (mr *MockCacheMockRecorder) XGroupCount(ctx, stream interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XGroupCount", reflect.TypeOf((*MockCache)(nil).XGroupCount), ctx, stream)
+}
+
+// XGroupCreate mocks base method.
+func (m *MockCache) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XGroupCreate", ctx, stream, group, start)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// XGroupCreate indicates an expected call of XGroupCreate.
+func (mr *MockCacheMockRecorder) XGroupCreate(ctx, stream, group, start interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XGroupCreate", reflect.TypeOf((*MockCache)(nil).XGroupCreate), ctx, stream, group, start)
+}
+
+// XGroupDestroy mocks base method.
+func (m *MockCache) XGroupDestroy(ctx context.Context, stream, group string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XGroupDestroy", ctx, stream, group)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// XGroupDestroy indicates an expected call of XGroupDestroy.
+func (mr *MockCacheMockRecorder) XGroupDestroy(ctx, stream, group interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XGroupDestroy", reflect.TypeOf((*MockCache)(nil).XGroupDestroy), ctx, stream, group)
+}
+
+// XReadGroup mocks base method.
+func (m *MockCache) XReadGroup(ctx context.Context, stream, group, consumer, id string, count int64, block time.Duration) ([]cache.StreamEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "XReadGroup", ctx, stream, group, consumer, id, count, block)
+	ret0, _ := ret[0].([]cache.StreamEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// XReadGroup indicates an expected call of XReadGroup.
+func (mr *MockCacheMockRecorder) XReadGroup(ctx, stream, group, consumer, id, count, block interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "XReadGroup", reflect.TypeOf((*MockCache)(nil).XReadGroup), ctx, stream, group, consumer, id, count, block)
+}
+
+// ZAdd mocks base method.
+func (m *MockCache) ZAdd(ctx context.Context, key, member string, score float64, ttl ...time.Duration) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, member, score}
+	for _, a := range ttl {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ZAdd", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ZAdd indicates an expected call of ZAdd.
+func (mr *MockCacheMockRecorder) ZAdd(ctx, key, member, score interface{}, ttl ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, member, score}, ttl...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ZAdd", reflect.TypeOf((*MockCache)(nil).ZAdd), varargs...)
+}
+
+// ZCount mocks base method.
+func (m *MockCache) ZCount(ctx context.Context, key, min, max string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ZCount", ctx, key, min, max)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ZCount indicates an expected call of ZCount.
+func (mr *MockCacheMockRecorder) ZCount(ctx, key, min, max interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ZCount", reflect.TypeOf((*MockCache)(nil).ZCount), ctx, key, min, max)
+}
+
+// ZRem mocks base method.
+func (m *MockCache) ZRem(ctx context.Context, key, member string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ZRem", ctx, key, member)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ZRem indicates an expected call of ZRem.
+func (mr *MockCacheMockRecorder) ZRem(ctx, key, member interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ZRem", reflect.TypeOf((*MockCache)(nil).ZRem), ctx, key, member)
+}
+
+// ZRemRangeByScore mocks base method.
+func (m *MockCache) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ZRemRangeByScore", ctx, key, min, max)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ZRemRangeByScore indicates an expected call of ZRemRangeByScore.
+func (mr *MockCacheMockRecorder) ZRemRangeByScore(ctx, key, min, max interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ZRemRangeByScore", reflect.TypeOf((*MockCache)(nil).ZRemRangeByScore), ctx, key, min, max)
+}
@@ -0,0 +1,156 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./internal/delivery/delivery.go
+
+// Package mock_delivery is a generated GoMock package.
+package mock_delivery
+
+import (
+	delivery "chat-session/internal/delivery"
+	model "chat-session/internal/model"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockService is a mock of Service interface.
+type MockService struct {
+	ctrl     *gomock.Controller
+	recorder *MockServiceMockRecorder
+}
+
+// MockServiceMockRecorder is the mock recorder for MockService.
+type MockServiceMockRecorder struct {
+	mock *MockService
+}
+
+// NewMockService creates a new mock instance.
+func NewMockService(ctrl *gomock.Controller) *MockService {
+	mock := &MockService{ctrl: ctrl}
+	mock.recorder = &MockServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockService) EXPECT() *MockServiceMockRecorder {
+	return m.recorder
+}
+
+// Fanout mocks base method.
+func (m_2 *MockService) Fanout(ctx context.Context, m model.ChatMessage, clientMsgId string, receivers []string) (delivery.Result, error) {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "Fanout", ctx, m, clientMsgId, receivers)
+	ret0, _ := ret[0].(delivery.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fanout indicates an expected call of Fanout.
+func (mr *MockServiceMockRecorder) Fanout(ctx, m, clientMsgId, receivers interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fanout", reflect.TypeOf((*MockService)(nil).Fanout), ctx, m, clientMsgId, receivers)
+}
+
+// MarkDelivered mocks base method.
+func (m *MockService) MarkDelivered(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDelivered", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDelivered indicates an expected call of MarkDelivered.
+func (mr *MockServiceMockRecorder) MarkDelivered(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDelivered", reflect.TypeOf((*MockService)(nil).MarkDelivered), ctx, id)
+}
+
+// Publish mocks base method.
+func (m *MockService) Publish(ctx context.Context, userId string, e model.Envelope) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", ctx, userId, e)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockServiceMockRecorder) Publish(ctx, userId, e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockService)(nil).Publish), ctx, userId, e)
+}
+
+// PublishRef mocks base method.
+func (m *MockService) PublishRef(ctx context.Context, userId string, msgId int64, clientMsgId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishRef", ctx, userId, msgId, clientMsgId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PublishRef indicates an expected call of PublishRef.
+func (mr *MockServiceMockRecorder) PublishRef(ctx, userId, msgId, clientMsgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRef", reflect.TypeOf((*MockService)(nil).PublishRef), ctx, userId, msgId, clientMsgId)
+}
+
+// Resolve mocks base method.
+func (m *MockService) Resolve(ctx context.Context, userId, payload string) ([]byte, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", ctx, userId, payload)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Resolve indicates an expected call of Resolve.
+func (mr *MockServiceMockRecorder) Resolve(ctx, userId, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockService)(nil).Resolve), ctx, userId, payload)
+}
+
+// Send mocks base method.
+func (m_2 *MockService) Send(ctx context.Context, m model.ChatMessage, clientMsgId string) (delivery.Result, error) {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "Send", ctx, m, clientMsgId)
+	ret0, _ := ret[0].(delivery.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockServiceMockRecorder) Send(ctx, m, clientMsgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockService)(nil).Send), ctx, m, clientMsgId)
+}
+
+// Spill mocks base method.
+func (m *MockService) Spill(ctx context.Context, userId, payload string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Spill", ctx, userId, payload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Spill indicates an expected call of Spill.
+func (mr *MockServiceMockRecorder) Spill(ctx, userId, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Spill", reflect.TypeOf((*MockService)(nil).Spill), ctx, userId, payload)
+}
+
+// Subscribe mocks base method.
+func (m *MockService) Subscribe(ctx context.Context, userId, deviceId string) (delivery.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", ctx, userId, deviceId)
+	ret0, _ := ret[0].(delivery.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockServiceMockRecorder) Subscribe(ctx, userId, deviceId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockService)(nil).Subscribe), ctx, userId, deviceId)
+}
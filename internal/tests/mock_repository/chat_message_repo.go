@@ -6,7 +6,9 @@ package mock_repository
 
 import (
 	repository "chat-session/internal/repository"
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,45 +36,193 @@ func (m *MockMessage) EXPECT() *MockMessageMockRecorder {
 	return m.recorder
 }
 
+// CountUnread mocks base method.
+func (m *MockMessage) CountUnread(ctx context.Context, receiverId string) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUnread", ctx, receiverId)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUnread indicates an expected call of CountUnread.
+func (mr *MockMessageMockRecorder) CountUnread(ctx, receiverId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUnread", reflect.TypeOf((*MockMessage)(nil).CountUnread), ctx, receiverId)
+}
+
 // Create mocks base method.
-func (m *MockMessage) Create(entity repository.MessageEntity) error {
+func (m *MockMessage) Create(ctx context.Context, entity repository.MessageEntity) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", entity)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "Create", ctx, entity)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockMessageMockRecorder) Create(entity interface{}) *gomock.Call {
+func (mr *MockMessageMockRecorder) Create(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockMessage)(nil).Create), ctx, entity)
+}
+
+// CreateWithOutbox mocks base method.
+func (m *MockMessage) CreateWithOutbox(ctx context.Context, entity repository.MessageEntity) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWithOutbox", ctx, entity)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWithOutbox indicates an expected call of CreateWithOutbox.
+func (mr *MockMessageMockRecorder) CreateWithOutbox(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWithOutbox", reflect.TypeOf((*MockMessage)(nil).CreateWithOutbox), ctx, entity)
+}
+
+// FindByClientMsgId mocks base method.
+func (m *MockMessage) FindByClientMsgId(ctx context.Context, senderId, receiverId, clientMsgId string) (*repository.MessageEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByClientMsgId", ctx, senderId, receiverId, clientMsgId)
+	ret0, _ := ret[0].(*repository.MessageEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByClientMsgId indicates an expected call of FindByClientMsgId.
+func (mr *MockMessageMockRecorder) FindByClientMsgId(ctx, senderId, receiverId, clientMsgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByClientMsgId", reflect.TypeOf((*MockMessage)(nil).FindByClientMsgId), ctx, senderId, receiverId, clientMsgId)
+}
+
+// FindByIds mocks base method.
+func (m *MockMessage) FindByIds(ctx context.Context, receiverId string, ids []int64) ([]repository.MessageEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByIds", ctx, receiverId, ids)
+	ret0, _ := ret[0].([]repository.MessageEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByIds indicates an expected call of FindByIds.
+func (mr *MockMessageMockRecorder) FindByIds(ctx, receiverId, ids interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockMessage)(nil).Create), entity)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByIds", reflect.TypeOf((*MockMessage)(nil).FindByIds), ctx, receiverId, ids)
+}
+
+// FindConversation mocks base method.
+func (m *MockMessage) FindConversation(ctx context.Context, userId, peerId string, beforeId int64, limit int) ([]repository.MessageEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindConversation", ctx, userId, peerId, beforeId, limit)
+	ret0, _ := ret[0].([]repository.MessageEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindConversation indicates an expected call of FindConversation.
+func (mr *MockMessageMockRecorder) FindConversation(ctx, userId, peerId, beforeId, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindConversation", reflect.TypeOf((*MockMessage)(nil).FindConversation), ctx, userId, peerId, beforeId, limit)
+}
+
+// FindLastMessages mocks base method.
+func (m *MockMessage) FindLastMessages(ctx context.Context, userId string) ([]repository.MessageEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindLastMessages", ctx, userId)
+	ret0, _ := ret[0].([]repository.MessageEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindLastMessages indicates an expected call of FindLastMessages.
+func (mr *MockMessageMockRecorder) FindLastMessages(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLastMessages", reflect.TypeOf((*MockMessage)(nil).FindLastMessages), ctx, userId)
 }
 
 // FindNewMsgByReceiverId mocks base method.
-func (m *MockMessage) FindNewMsgByReceiverId(receiverId string) ([]repository.MessageEntity, error) {
+func (m *MockMessage) FindNewMsgByReceiverId(ctx context.Context, receiverId string) ([]repository.MessageEntity, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindNewMsgByReceiverId", receiverId)
+	ret := m.ctrl.Call(m, "FindNewMsgByReceiverId", ctx, receiverId)
 	ret0, _ := ret[0].([]repository.MessageEntity)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindNewMsgByReceiverId indicates an expected call of FindNewMsgByReceiverId.
-func (mr *MockMessageMockRecorder) FindNewMsgByReceiverId(receiverId interface{}) *gomock.Call {
+func (mr *MockMessageMockRecorder) FindNewMsgByReceiverId(ctx, receiverId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindNewMsgByReceiverId", reflect.TypeOf((*MockMessage)(nil).FindNewMsgByReceiverId), ctx, receiverId)
+}
+
+// FindPeers mocks base method.
+func (m *MockMessage) FindPeers(ctx context.Context, userId string, peerIds []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPeers", ctx, userId, peerIds)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPeers indicates an expected call of FindPeers.
+func (mr *MockMessageMockRecorder) FindPeers(ctx, userId, peerIds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPeers", reflect.TypeOf((*MockMessage)(nil).FindPeers), ctx, userId, peerIds)
+}
+
+// MarkDelivered mocks base method.
+func (m *MockMessage) MarkDelivered(ctx context.Context, ids []int64, n time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDelivered", ctx, ids, n)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDelivered indicates an expected call of MarkDelivered.
+func (mr *MockMessageMockRecorder) MarkDelivered(ctx, ids, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDelivered", reflect.TypeOf((*MockMessage)(nil).MarkDelivered), ctx, ids, n)
+}
+
+// MarkRead mocks base method.
+func (m *MockMessage) MarkRead(ctx context.Context, receiverId string, ids []int64, n time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRead", ctx, receiverId, ids, n)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRead indicates an expected call of MarkRead.
+func (mr *MockMessageMockRecorder) MarkRead(ctx, receiverId, ids, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRead", reflect.TypeOf((*MockMessage)(nil).MarkRead), ctx, receiverId, ids, n)
+}
+
+// MarkReadUntil mocks base method.
+func (m *MockMessage) MarkReadUntil(ctx context.Context, receiverId, senderId string, untilId int64, n time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkReadUntil", ctx, receiverId, senderId, untilId, n)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkReadUntil indicates an expected call of MarkReadUntil.
+func (mr *MockMessageMockRecorder) MarkReadUntil(ctx, receiverId, senderId, untilId, n interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindNewMsgByReceiverId", reflect.TypeOf((*MockMessage)(nil).FindNewMsgByReceiverId), receiverId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkReadUntil", reflect.TypeOf((*MockMessage)(nil).MarkReadUntil), ctx, receiverId, senderId, untilId, n)
 }
 
-// UpdateIsRead mocks base method.
-func (m *MockMessage) UpdateIsRead(ids []int64) error {
+// MarkUndelivered mocks base method.
+func (m *MockMessage) MarkUndelivered(ctx context.Context, ids []int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateIsRead", ids)
+	ret := m.ctrl.Call(m, "MarkUndelivered", ctx, ids)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateIsRead indicates an expected call of UpdateIsRead.
-func (mr *MockMessageMockRecorder) UpdateIsRead(ids interface{}) *gomock.Call {
+// MarkUndelivered indicates an expected call of MarkUndelivered.
+func (mr *MockMessageMockRecorder) MarkUndelivered(ctx, ids interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateIsRead", reflect.TypeOf((*MockMessage)(nil).UpdateIsRead), ids)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkUndelivered", reflect.TypeOf((*MockMessage)(nil).MarkUndelivered), ctx, ids)
 }
@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./internal/repository/chat_outbox.go
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	repository "chat-session/internal/repository"
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockOutbox is a mock of Outbox interface.
+type MockOutbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockOutboxMockRecorder
+}
+
+// MockOutboxMockRecorder is the mock recorder for MockOutbox.
+type MockOutboxMockRecorder struct {
+	mock *MockOutbox
+}
+
+// NewMockOutbox creates a new mock instance.
+func NewMockOutbox(ctrl *gomock.Controller) *MockOutbox {
+	mock := &MockOutbox{ctrl: ctrl}
+	mock.recorder = &MockOutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOutbox) EXPECT() *MockOutboxMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockOutbox) Claim(ctx context.Context, entity repository.OutboxEntity, until time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, entity, until)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockOutboxMockRecorder) Claim(ctx, entity, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockOutbox)(nil).Claim), ctx, entity, until)
+}
+
+// FindPending mocks base method.
+func (m *MockOutbox) FindPending(ctx context.Context, n time.Time, limit int) ([]repository.OutboxEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPending", ctx, n, limit)
+	ret0, _ := ret[0].([]repository.OutboxEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPending indicates an expected call of FindPending.
+func (mr *MockOutboxMockRecorder) FindPending(ctx, n, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPending", reflect.TypeOf((*MockOutbox)(nil).FindPending), ctx, n, limit)
+}
+
+// MarkDispatched mocks base method.
+func (m *MockOutbox) MarkDispatched(ctx context.Context, id int64, n time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDispatched", ctx, id, n)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDispatched indicates an expected call of MarkDispatched.
+func (mr *MockOutboxMockRecorder) MarkDispatched(ctx, id, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDispatched", reflect.TypeOf((*MockOutbox)(nil).MarkDispatched), ctx, id, n)
+}
+
+// PurgeDispatched mocks base method.
+func (m *MockOutbox) PurgeDispatched(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDispatched", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDispatched indicates an expected call of PurgeDispatched.
+func (mr *MockOutboxMockRecorder) PurgeDispatched(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDispatched", reflect.TypeOf((*MockOutbox)(nil).PurgeDispatched), ctx, before)
+}
+
+// Retry mocks base method.
+func (m *MockOutbox) Retry(ctx context.Context, id int64, attempts int, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", ctx, id, attempts, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *MockOutboxMockRecorder) Retry(ctx, id, attempts, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*MockOutbox)(nil).Retry), ctx, id, attempts, next)
+}
@@ -0,0 +1,181 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./internal/repository/chat_room.go
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	repository "chat-session/internal/repository"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRoom is a mock of Room interface.
+type MockRoom struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoomMockRecorder
+}
+
+// MockRoomMockRecorder is the mock recorder for MockRoom.
+type MockRoomMockRecorder struct {
+	mock *MockRoom
+}
+
+// NewMockRoom creates a new mock instance.
+func NewMockRoom(ctrl *gomock.Controller) *MockRoom {
+	mock := &MockRoom{ctrl: ctrl}
+	mock.recorder = &MockRoomMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoom) EXPECT() *MockRoomMockRecorder {
+	return m.recorder
+}
+
+// AddMember mocks base method.
+func (m *MockRoom) AddMember(ctx context.Context, entity repository.MemberEntity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMember", ctx, entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddMember indicates an expected call of AddMember.
+func (mr *MockRoomMockRecorder) AddMember(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMember", reflect.TypeOf((*MockRoom)(nil).AddMember), ctx, entity)
+}
+
+// Create mocks base method.
+func (m *MockRoom) Create(ctx context.Context, entity repository.RoomEntity, members []repository.MemberEntity) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, entity, members)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRoomMockRecorder) Create(ctx, entity, members interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRoom)(nil).Create), ctx, entity, members)
+}
+
+// FindById mocks base method.
+func (m *MockRoom) FindById(ctx context.Context, id int64) (*repository.RoomEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, id)
+	ret0, _ := ret[0].(*repository.RoomEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockRoomMockRecorder) FindById(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockRoom)(nil).FindById), ctx, id)
+}
+
+// FindMember mocks base method.
+func (m *MockRoom) FindMember(ctx context.Context, roomId int64, userId string) (*repository.MemberEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMember", ctx, roomId, userId)
+	ret0, _ := ret[0].(*repository.MemberEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMember indicates an expected call of FindMember.
+func (mr *MockRoomMockRecorder) FindMember(ctx, roomId, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMember", reflect.TypeOf((*MockRoom)(nil).FindMember), ctx, roomId, userId)
+}
+
+// FindMembers mocks base method.
+func (m *MockRoom) FindMembers(ctx context.Context, roomId int64) ([]repository.MemberEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMembers", ctx, roomId)
+	ret0, _ := ret[0].([]repository.MemberEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMembers indicates an expected call of FindMembers.
+func (mr *MockRoomMockRecorder) FindMembers(ctx, roomId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMembers", reflect.TypeOf((*MockRoom)(nil).FindMembers), ctx, roomId)
+}
+
+// FindRoommates mocks base method.
+func (m *MockRoom) FindRoommates(ctx context.Context, userId string, peerIds []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRoommates", ctx, userId, peerIds)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRoommates indicates an expected call of FindRoommates.
+func (mr *MockRoomMockRecorder) FindRoommates(ctx, userId, peerIds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRoommates", reflect.TypeOf((*MockRoom)(nil).FindRoommates), ctx, userId, peerIds)
+}
+
+// LeaveOwner mocks base method.
+func (m *MockRoom) LeaveOwner(ctx context.Context, roomId int64, ownerId, successorId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaveOwner", ctx, roomId, ownerId, successorId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LeaveOwner indicates an expected call of LeaveOwner.
+func (mr *MockRoomMockRecorder) LeaveOwner(ctx, roomId, ownerId, successorId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaveOwner", reflect.TypeOf((*MockRoom)(nil).LeaveOwner), ctx, roomId, ownerId, successorId)
+}
+
+// RemoveMember mocks base method.
+func (m *MockRoom) RemoveMember(ctx context.Context, roomId int64, userId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMember", ctx, roomId, userId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMember indicates an expected call of RemoveMember.
+func (mr *MockRoomMockRecorder) RemoveMember(ctx, roomId, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockRoom)(nil).RemoveMember), ctx, roomId, userId)
+}
+
+// TransferOwner mocks base method.
+func (m *MockRoom) TransferOwner(ctx context.Context, roomId int64, ownerId, successorId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferOwner", ctx, roomId, ownerId, successorId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TransferOwner indicates an expected call of TransferOwner.
+func (mr *MockRoomMockRecorder) TransferOwner(ctx, roomId, ownerId, successorId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferOwner", reflect.TypeOf((*MockRoom)(nil).TransferOwner), ctx, roomId, ownerId, successorId)
+}
+
+// UpdateRole mocks base method.
+func (m *MockRoom) UpdateRole(ctx context.Context, roomId int64, userId, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRole", ctx, roomId, userId, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRole indicates an expected call of UpdateRole.
+func (mr *MockRoomMockRecorder) UpdateRole(ctx, roomId, userId, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRole", reflect.TypeOf((*MockRoom)(nil).UpdateRole), ctx, roomId, userId, role)
+}
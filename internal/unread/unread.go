@@ -0,0 +1,90 @@
+package unread
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/repository"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	rdbUnread = "%s-unread"
+	//loadedField marks the hash as rebuilt from database, only a loaded hash takes increments
+	loadedField = "_loaded"
+	//loadingField holds token of the All call rebuilding the hash, an Incr during the rebuild removes it
+	loadingField = "_loading"
+)
+
+// Counter keeps unread count per peer in cache so inbox does not need to count chat_message on every load
+type Counter interface {
+	Incr(ctx context.Context, userId, peerId string) error
+	Invalidate(ctx context.Context, userId string) error
+	All(ctx context.Context, userId string) (map[string]int64, error)
+}
+
+type counter struct {
+	cache       cache.Cache
+	messageRepo repository.Message
+}
+
+func NewCounter(cache cache.Cache, messageRepo repository.Message) Counter {
+	return &counter{
+		cache:       cache,
+		messageRepo: messageRepo,
+	}
+}
+
+// Incr counts one more unread message, a hash not loaded yet is dropped instead so a rebuild in progress is not kept
+func (c counter) Incr(ctx context.Context, userId, peerId string) error {
+	key := fmt.Sprintf(rdbUnread, userId)
+	ok, err := c.cache.HIncrByIfExists(ctx, key, loadedField, peerId, 1)
+	if err != nil || ok {
+		return err
+	}
+	return c.cache.Del(ctx, key)
+}
+
+// Invalidate drops cached counters, next All rebuilds them from database
+func (c counter) Invalidate(ctx context.Context, userId string) error {
+	return c.cache.Del(ctx, fmt.Sprintf(rdbUnread, userId))
+}
+
+func (c counter) All(ctx context.Context, userId string) (map[string]int64, error) {
+	key := fmt.Sprintf(rdbUnread, userId)
+	values, err := c.cache.HGetAll(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := values[loadedField]; ok {
+		counts := make(map[string]int64, len(values))
+		for peerId, v := range values {
+			if peerId == loadedField || peerId == loadingField {
+				continue
+			}
+			counts[peerId], _ = strconv.ParseInt(v, 10, 64)
+		}
+		return counts, nil
+	}
+
+	//cache miss then count from database, the result is kept only when no Incr happened while counting
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	err = c.cache.HSet(ctx, key, map[string]string{loadingField: token})
+	if err != nil {
+		return nil, err
+	}
+	counts, err := c.messageRepo.CountUnread(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	values = map[string]string{loadedField: "1"}
+	for peerId, count := range counts {
+		values[peerId] = strconv.FormatInt(count, 10)
+	}
+	_, err = c.cache.HSetIfEqual(ctx, key, loadingField, token, values)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
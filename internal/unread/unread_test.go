@@ -0,0 +1,73 @@
+package unread
+
+import (
+	"chat-session/internal/cache"
+	"chat-session/internal/config"
+	"chat-session/internal/tests/mock_repository"
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Incr(t *testing.T) {
+	ctx := context.Background()
+	tt := []struct {
+		name     string
+		loaded   bool
+		expected map[string]string
+	}{
+		{
+			name:     "should not create hash when counters are not loaded",
+			expected: map[string]string{},
+		},
+		{
+			name:     "should increment when counters are loaded",
+			loaded:   true,
+			expected: map[string]string{loadedField: "1", "fifa": "3"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := cache.NewMemory(config.Env{RedisTTL: 60000})
+			if tc.loaded {
+				_ = c.HSet(ctx, "uefa-unread", map[string]string{loadedField: "1", "fifa": "2"})
+			}
+			assert.Nil(t, NewCounter(c, nil).Incr(ctx, "uefa", "fifa"))
+			values, _ := c.HGetAll(ctx, "uefa-unread")
+			assert.Equal(t, tc.expected, values)
+		})
+	}
+}
+
+func Test_All(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemory(config.Env{RedisTTL: 50})
+	repo := mock_repository.NewMockMessage(gomock.NewController(t))
+	counter := NewCounter(c, repo)
+
+	//message arrives while counting, the stale count must not be cached
+	repo.EXPECT().CountUnread(gomock.Any(), "uefa").DoAndReturn(func(context.Context, string) (map[string]int64, error) {
+		assert.Nil(t, counter.Incr(ctx, "uefa", "fifa"))
+		return map[string]int64{"fifa": 1}, nil
+	})
+	counts, err := counter.All(ctx, "uefa")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"fifa": 1}, counts)
+
+	//next call rebuilds and keeps the result
+	repo.EXPECT().CountUnread(gomock.Any(), "uefa").Return(map[string]int64{"fifa": 2}, nil)
+	counts, err = counter.All(ctx, "uefa")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"fifa": 2}, counts)
+	assert.Nil(t, counter.Incr(ctx, "uefa", "fifa"))
+	counts, err = counter.All(ctx, "uefa")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"fifa": 3}, counts)
+
+	//loaded hash expires like every cached value
+	time.Sleep(60 * time.Millisecond)
+	values, _ := c.HGetAll(ctx, "uefa-unread")
+	assert.Empty(t, values)
+}